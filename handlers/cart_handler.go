@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"shopping_cart/models"
+	"shopping_cart/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CartHandler struct {
+	cartService     *services.CartService
+	discountService *services.DiscountService
+	couponService   *services.CouponService
+}
+
+func NewCartHandler(cartService *services.CartService, discountService *services.DiscountService, couponService *services.CouponService) *CartHandler {
+	return &CartHandler{cartService: cartService, discountService: discountService, couponService: couponService}
+}
+
+type createCartRequest struct {
+	UserID   int64  `json:"user_id"`
+	Currency string `json:"currency"` // 空白時使用預設貨幣
+}
+
+// 設定商品目錄時不可提供 unit_price、category、brand 與 tags
+type addCartItemRequest struct {
+	ProductID int64          `json:"product_id" binding:"required"`
+	UnitPrice models.Decimal `json:"unit_price"`
+	Quantity  int            `json:"quantity" binding:"required"`
+	Category  string         `json:"category"`
+	Brand     string         `json:"brand"`
+	Tags      []string       `json:"tags"`
+}
+
+type updateCartItemRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+type setShippingRequest struct {
+	ShippingFee models.Decimal `json:"shipping_fee"`
+}
+
+type applyCouponRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type applyDiscountRequest struct {
+	UserID     int64          `json:"user_id"`    // 選填，需與購物車的用戶相同
+	CartTotal  models.Decimal `json:"cart_total"` // 正式環境不接受，以購物車明細計算
+	ProductIDs []int64        `json:"product_ids"`
+	Strategy   string         `json:"strategy"` // PRIORITY 或 MAX_SAVINGS，空白時為 MAX_SAVINGS
+}
+
+func (h *CartHandler) CreateCart(c *gin.Context) {
+	var req createCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.CreateCartInCurrency(c.Request.Context(), req.UserID, models.Currency(req.Currency))
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cart)
+}
+
+func (h *CartHandler) GetCart(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	cart, err := h.cartService.GetCart(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+func (h *CartHandler) AddItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req addCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.AddItem(c.Request.Context(), id, services.CartItemInput{
+		ProductID: req.ProductID,
+		UnitPrice: req.UnitPrice,
+		Quantity:  req.Quantity,
+		Category:  req.Category,
+		Brand:     req.Brand,
+		Tags:      req.Tags,
+	})
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	productID, err := strconv.ParseInt(c.Param("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var req updateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.UpdateItemQuantity(c.Request.Context(), id, productID, req.Quantity)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+func (h *CartHandler) SetShipping(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req setShippingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.SetShippingFee(c.Request.Context(), id, req.ShippingFee)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	productID, err := strconv.ParseInt(c.Param("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	if err := h.cartService.RemoveItem(c.Request.Context(), id, productID); err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *CartHandler) ApplyDiscount(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req applyDiscountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, err := parseCartStrategy(req.Strategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.GetCart(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 會員等級與個人使用上限一律以購物車的用戶為準
+	if req.UserID != 0 && req.UserID != cart.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user_id does not match the cart owner"})
+		return
+	}
+
+	lines, err := h.cartService.PricedLines(c.Request.Context(), cart)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	coupons, err := h.couponService.CartCoupons(c.Request.Context(), cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	application, err := h.discountService.ApplyDiscounts(c.Request.Context(), services.ApplyDiscountInput{
+		CartID:      cart.ID,
+		UserID:      cart.UserID,
+		CartTotal:   req.CartTotal,
+		ProductIDs:  req.ProductIDs,
+		Lines:       lines,
+		Strategy:    strategy,
+		Coupons:     coupons,
+		Currency:    cart.Currency,
+		ShippingFee: cart.ShippingFee,
+	})
+	if errors.Is(err, services.ErrClientTotalRejected) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, application)
+}
+
+func (h *CartHandler) ApplyCoupon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req applyCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.couponService.ApplyCoupon(c.Request.Context(), id, req.Code); err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	// 優惠碼可能讓 GIFT 折扣符合資格
+	if err := h.cartService.SyncGifts(c.Request.Context(), id); err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.GetCart(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+func (h *CartHandler) RemoveCoupon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.couponService.RemoveCoupon(c.Request.Context(), id, c.Param("code")); err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.cartService.SyncGifts(c.Request.Context(), id); err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseCartStrategy 解析購物車與結帳的疊加策略，空白時為用戶選擇折抵最多的組合
+func parseCartStrategy(value string) (services.StackingStrategy, error) {
+	if strings.TrimSpace(value) == "" {
+		return services.StrategyMaxSavings, nil
+	}
+	return services.ParseStackingStrategy(value)
+}
+
+// cartErrorStatus 將購物車服務的錯誤對應到 HTTP 狀態碼
+func cartErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound),
+		errors.Is(err, services.ErrCartItemNotFound),
+		errors.Is(err, services.ErrCouponNotFound),
+		errors.Is(err, services.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCartNotOpen),
+		errors.Is(err, services.ErrProductInactive),
+		errors.Is(err, services.ErrProductCurrencyMismatch),
+		errors.Is(err, services.ErrCouponExpired),
+		errors.Is(err, services.ErrCouponUsedUp),
+		errors.Is(err, services.ErrCouponAlreadyApplied):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidQuantity),
+		errors.Is(err, services.ErrInvalidUnitPrice),
+		errors.Is(err, services.ErrCatalogFieldsSet),
+		errors.Is(err, services.ErrInvalidShippingFee),
+		errors.Is(err, models.ErrInvalidCurrency):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"shopping_cart/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CheckoutHandler struct {
+	checkoutService *services.CheckoutService
+}
+
+func NewCheckoutHandler(checkoutService *services.CheckoutService) *CheckoutHandler {
+	return &CheckoutHandler{checkoutService: checkoutService}
+}
+
+type checkoutRequest struct {
+	DiscountIDs []int64 `json:"discount_ids" binding:"required"` // 用戶在購物車看到的折扣，沒有折扣時為空陣列
+	Strategy    string  `json:"strategy"`                        // 需與 apply-discount 相同，空白時為 MAX_SAVINGS
+}
+
+func (h *CheckoutHandler) Checkout(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req checkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, err := parseCartStrategy(req.Strategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.checkoutService.Checkout(c.Request.Context(), services.CheckoutInput{
+		CartID:              id,
+		ExpectedDiscountIDs: req.DiscountIDs,
+		Strategy:            strategy,
+	})
+	if err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// StartCheckout 計算最終價格並保留限量折扣的名額
+func (h *CheckoutHandler) StartCheckout(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req checkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, err := parseCartStrategy(req.Strategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.checkoutService.StartCheckout(c.Request.Context(), services.CheckoutInput{
+		CartID:              id,
+		ExpectedDiscountIDs: req.DiscountIDs,
+		Strategy:            strategy,
+	})
+	if err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// CancelCheckout 放棄結帳並釋放保留的名額
+func (h *CheckoutHandler) CancelCheckout(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.checkoutService.CancelCheckout(c.Request.Context(), id); err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *CheckoutHandler) GetOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	order, err := h.checkoutService.GetOrder(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *CheckoutHandler) CancelOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	order, err := h.checkoutService.CancelOrder(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *CheckoutHandler) RefundOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	order, err := h.checkoutService.RefundOrder(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// checkoutErrorStatus 將結帳服務的錯誤對應到 HTTP 狀態碼
+func checkoutErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound),
+		errors.Is(err, services.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCartEmpty),
+		errors.Is(err, services.ErrExpectedDiscountsNeeded):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCartNotOpen),
+		errors.Is(err, services.ErrOrderNotReversible),
+		errors.Is(err, services.ErrDiscountUsageExceeded),
+		errors.Is(err, services.ErrCouponUsedUp),
+		errors.Is(err, services.ErrDiscountUserLimitExceeded),
+		errors.Is(err, services.ErrGiftOutOfStock),
+		errors.Is(err, services.ErrProductInactive),
+		errors.Is(err, services.ErrProductCurrencyMismatch),
+		errors.Is(err, services.ErrAppliedDiscountsChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
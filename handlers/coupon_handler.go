@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"shopping_cart/models"
+	"shopping_cart/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CouponHandler struct {
+	couponService *services.CouponService
+}
+
+func NewCouponHandler(couponService *services.CouponService) *CouponHandler {
+	return &CouponHandler{couponService: couponService}
+}
+
+type createCouponRequest struct {
+	Code           string     `json:"code" binding:"required"`
+	MaxRedemptions int        `json:"max_redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+type generateCouponsRequest struct {
+	Count          int        `json:"count" binding:"required"`
+	Prefix         string     `json:"prefix"`
+	Length         int        `json:"length"`
+	MaxRedemptions *int       `json:"max_redemptions"` // 省略時為單次使用，0 為不限次數
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	discountID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req createCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon := &models.Coupon{
+		DiscountID:     discountID,
+		Code:           req.Code,
+		MaxRedemptions: req.MaxRedemptions,
+		ExpiresAt:      req.ExpiresAt,
+	}
+	if err := h.couponService.CreateCoupon(c.Request.Context(), coupon); err != nil {
+		c.JSON(couponErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+func (h *CouponHandler) GenerateCoupons(c *gin.Context) {
+	discountID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req generateCouponsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupons, err := h.couponService.GenerateCoupons(c.Request.Context(), services.GenerateCouponsInput{
+		DiscountID:     discountID,
+		Count:          req.Count,
+		Prefix:         req.Prefix,
+		Length:         req.Length,
+		MaxRedemptions: req.MaxRedemptions,
+		ExpiresAt:      req.ExpiresAt,
+	})
+	if err != nil {
+		c.JSON(couponErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupons)
+}
+
+// ValidateCoupon 檢查優惠碼是否可以使用
+func (h *CouponHandler) ValidateCoupon(c *gin.Context) {
+	coupon, err := h.couponService.ValidateCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		c.JSON(couponErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+func couponErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrCouponNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCouponExpired), errors.Is(err, services.ErrCouponUsedUp),
+		errors.Is(err, services.ErrCouponAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidCouponCode), errors.Is(err, services.ErrInvalidCouponCount),
+		errors.Is(err, services.ErrInvalidCouponLength), errors.Is(err, services.ErrInvalidRedemptions):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
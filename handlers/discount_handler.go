@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,10 +13,16 @@ import (
 
 type DiscountHandler struct {
 	discountService *services.DiscountService
+	productService  *services.ProductService
+	cartService     *services.CartService
 }
 
-func NewDiscountHandler(discountService *services.DiscountService) *DiscountHandler {
-	return &DiscountHandler{discountService: discountService}
+func NewDiscountHandler(discountService *services.DiscountService, productService *services.ProductService, cartService *services.CartService) *DiscountHandler {
+	return &DiscountHandler{
+		discountService: discountService,
+		productService:  productService,
+		cartService:     cartService,
+	}
 }
 
 func (h *DiscountHandler) CreateDiscount(c *gin.Context) {
@@ -26,7 +33,7 @@ func (h *DiscountHandler) CreateDiscount(c *gin.Context) {
 	}
 
 	if err := h.discountService.CreateDiscount(c.Request.Context(), &discount); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(discountErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -47,7 +54,7 @@ func (h *DiscountHandler) UpdateDiscount(c *gin.Context) {
 	}
 
 	if err := h.discountService.UpdateDiscount(c.Request.Context(), id, &discount); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(discountErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -69,21 +76,124 @@ func (h *DiscountHandler) DeleteDiscount(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// GetAvailableDiscounts 查詢可用折扣，quantities、categories、brands 與 tags 依 product_ids 的順序對應，
+// 每個商品的 tags 以逗號分隔，未提供數量時每個商品視為一件。
+// 設定商品目錄時，商品的價格、類別、品牌與標籤以目錄為準，忽略請求中的 categories、brands 與 tags。
+// 提供 cart_id 時改以購物車的商品查詢，總額由伺服器端計算
 func (h *DiscountHandler) GetAvailableDiscounts(c *gin.Context) {
+	if c.Query("cart_id") != "" {
+		h.getCartDiscounts(c)
+		return
+	}
+
 	userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
-	cartTotal, _ := strconv.ParseFloat(c.Query("cart_total"), 64)
+	var cartTotal models.Decimal
+	if value := c.Query("cart_total"); value != "" {
+		parsed, err := models.ParseDecimal(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cart_total"})
+			return
+		}
+		cartTotal = parsed
+	}
+	currency, err := models.ParseCurrency(c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency"})
+		return
+	}
 	productIDsStr := c.QueryArray("product_ids")
-	productIDs := make([]int64, len(productIDsStr))
+	quantitiesStr := c.QueryArray("quantities")
+	categories := c.QueryArray("categories")
+	brands := c.QueryArray("brands")
+	tags := c.QueryArray("tags")
+	if len(quantitiesStr) > 0 && len(quantitiesStr) != len(productIDsStr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantities must match product_ids"})
+		return
+	}
+	if len(categories) > 0 && len(categories) != len(productIDsStr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "categories must match product_ids"})
+		return
+	}
+	if len(brands) > 0 && len(brands) != len(productIDsStr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "brands must match product_ids"})
+		return
+	}
+	if len(tags) > 0 && len(tags) != len(productIDsStr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tags must match product_ids"})
+		return
+	}
+
+	lines := make([]services.CartLine, len(productIDsStr))
 	for i, idStr := range productIDsStr {
 		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
 			return
 		}
-		productIDs[i] = id
+		lines[i] = services.CartLine{ProductID: id, Quantity: 1}
+
+		if len(quantitiesStr) > 0 {
+			quantity, err := strconv.Atoi(quantitiesStr[i])
+			if err != nil || quantity <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid quantity"})
+				return
+			}
+			lines[i].Quantity = quantity
+		}
+		if len(categories) > 0 {
+			lines[i].Category = categories[i]
+		}
+		if len(brands) > 0 {
+			lines[i].Brand = brands[i]
+		}
+		if len(tags) > 0 {
+			lines[i].Tags = models.SplitTags(tags[i])
+		}
+	}
+
+	if h.productService != nil {
+		lines, err = h.productService.CatalogLines(c.Request.Context(), lines, currency)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	discounts, err := h.discountService.GetAvailableDiscounts(c.Request.Context(), userID, cartTotal, productIDs)
+	discounts, err := h.discountService.FindAvailableDiscounts(c.Request.Context(), services.DiscountQuery{
+		UserID:    userID,
+		CartTotal: cartTotal,
+		Lines:     lines,
+		Currency:  currency,
+	})
+	if err != nil {
+		c.JSON(discountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, discounts)
+}
+
+// getCartDiscounts 以購物車的商品與伺服器端計算的總額查詢可用折扣
+func (h *DiscountHandler) getCartDiscounts(c *gin.Context) {
+	cartID, err := strconv.ParseInt(c.Query("cart_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cart_id"})
+		return
+	}
+	for _, param := range []string{"cart_total", "product_ids", "currency", "user_id"} {
+		if _, ok := c.GetQuery(param); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " cannot be combined with cart_id"})
+			return
+		}
+	}
+
+	cart, err := h.cartService.GetCart(c.Request.Context(), cartID)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	discounts, err := h.discountService.FindCartDiscounts(c.Request.Context(), cart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -91,3 +201,35 @@ func (h *DiscountHandler) GetAvailableDiscounts(c *gin.Context) {
 
 	c.JSON(http.StatusOK, discounts)
 }
+
+// GetUserDiscountUsage 回傳用戶各折扣的剩餘使用次數
+func (h *DiscountHandler) GetUserDiscountUsage(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	usages, err := h.discountService.GetUserDiscountUsage(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usages)
+}
+
+func discountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidCurrency),
+		errors.Is(err, services.ErrInvalidBOGORule),
+		errors.Is(err, services.ErrInvalidDiscountTier),
+		errors.Is(err, services.ErrInvalidBundle),
+		errors.Is(err, services.ErrInvalidGift),
+		errors.Is(err, services.ErrInvalidDiscountTarget),
+		errors.Is(err, services.ErrClientTotalRejected):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
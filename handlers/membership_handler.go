@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"shopping_cart/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MembershipHandler struct {
+	membershipService *services.MembershipService
+	cartService       *services.CartService
+}
+
+func NewMembershipHandler(membershipService *services.MembershipService, cartService *services.CartService) *MembershipHandler {
+	return &MembershipHandler{membershipService: membershipService, cartService: cartService}
+}
+
+type setMembershipRequest struct {
+	Tier string `json:"tier" binding:"required"`
+}
+
+func (h *MembershipHandler) GetMembership(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	tier, err := h.membershipService.GetMembershipTier(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "tier": tier})
+}
+
+func (h *MembershipHandler) SetMembership(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req setMembershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	membership, err := h.membershipService.SetMembershipTier(c.Request.Context(), userID, req.Tier)
+	if errors.Is(err, services.ErrInvalidMembershipTier) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 會員等級可能改變 GIFT 折扣的資格
+	if err := h.cartService.SyncUserGifts(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, membership)
+}
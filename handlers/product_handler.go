@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"shopping_cart/models"
+	"shopping_cart/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProductHandler struct {
+	productService *services.ProductService
+}
+
+func NewProductHandler(productService *services.ProductService) *ProductHandler {
+	return &ProductHandler{productService: productService}
+}
+
+type productRequest struct {
+	Name     string         `json:"name" binding:"required"`
+	Price    models.Decimal `json:"price"`
+	Currency string         `json:"currency"` // 空白時使用預設貨幣
+	Category string         `json:"category"`
+	Brand    string         `json:"brand"`
+	Tags     []string       `json:"tags"`
+	Active   *bool          `json:"active"` // 未提供時為上架
+}
+
+func (r productRequest) product() *models.Product {
+	product := &models.Product{
+		Name:     r.Name,
+		Price:    r.Price,
+		Currency: models.Currency(r.Currency),
+		Category: r.Category,
+		Brand:    r.Brand,
+		Tags:     models.JoinTags(r.Tags),
+		Active:   true,
+	}
+	if r.Active != nil {
+		product.Active = *r.Active
+	}
+	return product
+}
+
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	var req productRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product := req.product()
+	if err := h.productService.CreateProduct(c.Request.Context(), product); err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+func (h *ProductHandler) GetProduct(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	product, err := h.productService.GetProduct(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// ListProducts 列出商品，active=true 時只列出上架中的商品
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	activeOnly := false
+	if value := c.Query("active"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid active"})
+			return
+		}
+		activeOnly = parsed
+	}
+
+	products, err := h.productService.ListProducts(c.Request.Context(), activeOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, products)
+}
+
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req productRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product := req.product()
+	if err := h.productService.UpdateProduct(c.Request.Context(), id, product); err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.productService.DeleteProduct(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func productErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrProductInactive),
+		errors.Is(err, services.ErrProductCurrencyMismatch):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidProduct),
+		errors.Is(err, models.ErrInvalidCurrency):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
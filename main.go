@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
 	"shopping_cart/handlers"
 	"shopping_cart/models"
 	"shopping_cart/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
@@ -23,16 +27,70 @@ func main() {
 		&models.Discount{},
 		&models.DiscountCondition{},
 		&models.DiscountProduct{},
+		&models.DiscountCurrencyValue{},
+		&models.BOGORule{},
+		&models.DiscountTier{},
+		&models.BundleItem{},
+		&models.DiscountTarget{},
+		&models.Product{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderDiscount{},
+		&models.UserMembership{},
+		&models.Coupon{},
+		&models.CartCoupon{},
+		&models.DiscountRedemption{},
+		&models.DiscountReservation{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
 	// 初始化服務層
-	discountService := services.NewDiscountService(db)
+	membershipService := services.NewMembershipService(db)
+	// 以新台幣為基準的固定匯率，用於換算其他貨幣購物車的折扣金額
+	exchangeRates, err := services.NewStaticExchangeRates(map[models.Currency]string{
+		models.TWD: "1",
+		models.USD: "31.5",
+	})
+	if err != nil {
+		log.Fatalf("Failed to load exchange rates: %v", err)
+	}
+	// 折扣後每筆明細與整台購物車的最低金額 (MIN_LINE_TOTAL、MIN_CART_TOTAL)，未設定時不限制
+	minLineTotal, err := decimalEnv("MIN_LINE_TOTAL")
+	if err != nil {
+		log.Fatalf("Failed to load price floors: %v", err)
+	}
+	minCartTotal, err := decimalEnv("MIN_CART_TOTAL")
+	if err != nil {
+		log.Fatalf("Failed to load price floors: %v", err)
+	}
+	// 正式環境 (GIN_MODE=release) 不接受客戶端提供的購物車總額
+	discountService := services.NewDiscountService(db).
+		WithMembershipProvider(membershipService).
+		WithExchangeRates(exchangeRates).
+		WithPriceFloors(minLineTotal, minCartTotal).
+		WithClientTotals(gin.Mode() != gin.ReleaseMode)
+	productService := services.NewProductService(db)
+	cartService := services.NewCartService(db).
+		WithDiscountService(discountService).
+		WithProductService(productService)
+	couponService := services.NewCouponService(db)
+	checkoutService := services.NewCheckoutService(db, discountService).
+		WithProductService(productService)
+
+	// 定期釋放逾時未付款的折扣保留
+	discountService.StartReservationSweeper(context.Background(), time.Minute)
 
 	// 初始化路由
 	r := gin.Default()
-	discountHandler := handlers.NewDiscountHandler(discountService)
+	discountHandler := handlers.NewDiscountHandler(discountService, productService, cartService)
+	cartHandler := handlers.NewCartHandler(cartService, discountService, couponService)
+	couponHandler := handlers.NewCouponHandler(couponService)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService)
+	membershipHandler := handlers.NewMembershipHandler(membershipService, cartService)
+	productHandler := handlers.NewProductHandler(productService)
 
 	// 設置折扣相關路由
 	discountRoutes := r.Group("/discounts")
@@ -41,6 +99,54 @@ func main() {
 		discountRoutes.PUT("/:id", discountHandler.UpdateDiscount)
 		discountRoutes.DELETE("/:id", discountHandler.DeleteDiscount)
 		discountRoutes.GET("", discountHandler.GetAvailableDiscounts)
+		discountRoutes.POST("/:id/coupons", couponHandler.CreateCoupon)
+		discountRoutes.POST("/:id/coupons/generate", couponHandler.GenerateCoupons)
+	}
+
+	// 設置商品目錄相關路由
+	productRoutes := r.Group("/products")
+	{
+		productRoutes.POST("", productHandler.CreateProduct)
+		productRoutes.GET("", productHandler.ListProducts)
+		productRoutes.GET("/:id", productHandler.GetProduct)
+		productRoutes.PUT("/:id", productHandler.UpdateProduct)
+		productRoutes.DELETE("/:id", productHandler.DeleteProduct)
+	}
+
+	// 設置優惠碼相關路由
+	r.GET("/coupons/:code", couponHandler.ValidateCoupon)
+
+	// 設置購物車相關路由
+	cartRoutes := r.Group("/carts")
+	{
+		cartRoutes.POST("", cartHandler.CreateCart)
+		cartRoutes.GET("/:id", cartHandler.GetCart)
+		cartRoutes.POST("/:id/items", cartHandler.AddItem)
+		cartRoutes.PUT("/:id/items/:product_id", cartHandler.UpdateItem)
+		cartRoutes.DELETE("/:id/items/:product_id", cartHandler.RemoveItem)
+		cartRoutes.PUT("/:id/shipping", cartHandler.SetShipping)
+		cartRoutes.POST("/:id/coupons", cartHandler.ApplyCoupon)
+		cartRoutes.DELETE("/:id/coupons/:code", cartHandler.RemoveCoupon)
+		cartRoutes.POST("/:id/apply-discount", cartHandler.ApplyDiscount)
+		cartRoutes.POST("/:id/checkout/start", checkoutHandler.StartCheckout)
+		cartRoutes.DELETE("/:id/checkout", checkoutHandler.CancelCheckout)
+		cartRoutes.POST("/:id/checkout", checkoutHandler.Checkout)
+	}
+
+	// 設置訂單相關路由
+	orderRoutes := r.Group("/orders")
+	{
+		orderRoutes.GET("/:id", checkoutHandler.GetOrder)
+		orderRoutes.POST("/:id/cancel", checkoutHandler.CancelOrder)
+		orderRoutes.POST("/:id/refund", checkoutHandler.RefundOrder)
+	}
+
+	// 設置會員相關路由
+	userRoutes := r.Group("/users")
+	{
+		userRoutes.GET("/:id/membership", membershipHandler.GetMembership)
+		userRoutes.PUT("/:id/membership", membershipHandler.SetMembership)
+		userRoutes.GET("/:id/discount-usage", discountHandler.GetUserDiscountUsage)
 	}
 
 	// 啟動服務器
@@ -48,3 +154,19 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// decimalEnv 讀取金額設定，未設定時為 0
+func decimalEnv(name string) (models.Decimal, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return models.Decimal{}, nil
+	}
+	d, err := models.ParseDecimal(value)
+	if err != nil {
+		return models.Decimal{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if d.IsNegative() {
+		return models.Decimal{}, fmt.Errorf("%s cannot be negative", name)
+	}
+	return d, nil
+}
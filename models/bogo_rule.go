@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// BOGO 的計算方式
+type BOGOMode string
+
+const (
+	BOGOSameItem     BOGOMode = "SAME_ITEM"     // 同一商品買X件，第X+1件起的Y件打折
+	BOGOCheapest     BOGOMode = "CHEAPEST"      // 適用商品合併計算，最便宜的Y件打折
+	BOGOCrossProduct BOGOMode = "CROSS_PRODUCT" // 買適用商品X件，GetProductID 的商品Y件打折
+)
+
+// BOGO 折扣的結構化規則，例如「買3送1」、「買2件第3件5折」、「買A送B」
+type BOGORule struct {
+	ID           int64     `json:"id" gorm:"primaryKey"`
+	DiscountID   int64     `json:"discount_id" gorm:"uniqueIndex"`
+	Mode         BOGOMode  `json:"mode" gorm:"size:20"`                  // 空白時為 SAME_ITEM
+	BuyQuantity  int       `json:"buy_quantity"`                         // 需購買的件數 X
+	GetQuantity  int       `json:"get_quantity"`                         // 打折的件數 Y
+	GetPercent   Decimal   `json:"get_percent" gorm:"type:decimal(5,2)"` // 打折件數的折扣百分比，0 視為 100 (免費)
+	GetProductID int64     `json:"get_product_id,omitempty"`             // CROSS_PRODUCT 的贈送商品
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
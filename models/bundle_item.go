@@ -0,0 +1,9 @@
+package models
+
+// 組合折扣中必須一起購買的商品及數量
+type BundleItem struct {
+	ID         int64 `json:"id" gorm:"primaryKey"`
+	DiscountID int64 `json:"discount_id" gorm:"uniqueIndex:idx_bundle_product"`
+	ProductID  int64 `json:"product_id" gorm:"uniqueIndex:idx_bundle_product"`
+	Quantity   int   `json:"quantity"` // 每組需要的件數
+}
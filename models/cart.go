@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// 購物車狀態
+type CartStatus string
+
+const (
+	CartOpen       CartStatus = "OPEN"        // 購物中
+	CartCheckedOut CartStatus = "CHECKED_OUT" // 已結帳
+)
+
+type Cart struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"index"`
+	Status      CartStatus `json:"status" gorm:"size:50"`
+	Currency    Currency   `json:"currency" gorm:"size:3"`
+	ShippingFee Decimal    `json:"shipping_fee" gorm:"type:decimal(10,2)"` // 運費，與商品金額分開計算折扣
+	Subtotal    Decimal    `json:"subtotal" gorm:"-"`                      // 由 CartService 計算，不寫入資料庫
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Items   []CartItem   `json:"items" gorm:"foreignKey:CartID"`
+	Coupons []CartCoupon `json:"coupons" gorm:"foreignKey:CartID"`
+}
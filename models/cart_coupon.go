@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// 購物車已輸入的優惠碼，每個折扣最多一組
+type CartCoupon struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	CartID     int64     `json:"cart_id" gorm:"uniqueIndex:idx_cart_coupon_discount"`
+	DiscountID int64     `json:"discount_id" gorm:"uniqueIndex:idx_cart_coupon_discount"`
+	CouponID   int64     `json:"coupon_id"`
+	Code       string    `json:"code" gorm:"size:64"`
+	CreatedAt  time.Time `json:"created_at"`
+}
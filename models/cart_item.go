@@ -0,0 +1,41 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type CartItem struct {
+	ID             int64     `json:"id" gorm:"primaryKey"`
+	CartID         int64     `json:"cart_id" gorm:"index"`
+	ProductID      int64     `json:"product_id"`
+	UnitPrice      Decimal   `json:"unit_price" gorm:"type:decimal(10,2)"`
+	Quantity       int       `json:"quantity"`
+	GiftDiscountID int64     `json:"gift_discount_id,omitempty" gorm:"index"` // 由 GIFT 折扣自動加入的贈品
+	Category       string    `json:"category" gorm:"size:100"`
+	Brand          string    `json:"brand" gorm:"size:100"`
+	Tags           string    `json:"tags" gorm:"size:255"` // 以逗號分隔
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TagList 回傳商品標籤
+func (i CartItem) TagList() []string {
+	return SplitTags(i.Tags)
+}
+
+// SplitTags 拆解以逗號分隔的標籤，忽略空白的標籤
+func SplitTags(tags string) []string {
+	var list []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// JoinTags 將標籤以逗號合併後儲存
+func JoinTags(tags []string) string {
+	return strings.Join(SplitTags(strings.Join(tags, ",")), ",")
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// 優惠碼，輸入後才會套用對應的折扣
+type Coupon struct {
+	ID              int64      `json:"id" gorm:"primaryKey"`
+	DiscountID      int64      `json:"discount_id" gorm:"index"`
+	Code            string     `json:"code" gorm:"size:64;uniqueIndex"`
+	MaxRedemptions  int        `json:"max_redemptions"`  // 可使用次數，1 為單次使用，0 為不限次數
+	RedemptionCount int        `json:"redemption_count"` // 已使用次數
+	ExpiresAt       *time.Time `json:"expires_at"`       // 為空時不會過期
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Expired 判斷優惠碼在指定時間是否已過期
+func (c *Coupon) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// UsedUp 判斷優惠碼是否已達使用次數上限
+func (c *Coupon) UsedUp() bool {
+	return c.MaxRedemptions > 0 && c.RedemptionCount >= c.MaxRedemptions
+}
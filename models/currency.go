@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCurrency = errors.New("invalid currency code")
+
+// ISO 4217 貨幣代碼
+type Currency string
+
+const (
+	TWD Currency = "TWD"
+	USD Currency = "USD"
+)
+
+// 未指定貨幣的購物車與折扣視為預設貨幣
+const DefaultCurrency = TWD
+
+// ParseCurrency 解析三碼貨幣代碼，空白時回傳預設貨幣
+func ParseCurrency(value string) (Currency, error) {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if len(code) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return Currency(code), nil
+}
+
+// OrDefault 未指定時回傳預設貨幣
+func (c Currency) OrDefault() Currency {
+	if c == "" {
+		return DefaultCurrency
+	}
+	return c
+}
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// 小數位數，對應資料庫的 decimal(10,2)
+const decimalScale = 2
+
+var ErrInvalidDecimal = errors.New("invalid decimal")
+
+// 捨入模式
+type RoundingMode int
+
+const (
+	RoundHalfUp   RoundingMode = iota // 四捨五入 (0.5 遠離零)
+	RoundHalfEven                     // 銀行家捨入 (0.5 捨入到偶數)
+)
+
+// Decimal 是以百分之一為單位的定點小數，用於金額與百分比，避免 float64 的誤差
+type Decimal struct {
+	cents int64
+}
+
+// NewDecimal 以整數建立 Decimal
+func NewDecimal(units int64) Decimal {
+	return Decimal{cents: units * 100}
+}
+
+// DecimalFromCents 以百分之一為單位建立 Decimal
+func DecimalFromCents(cents int64) Decimal {
+	return Decimal{cents: cents}
+}
+
+// ParseDecimal 精確解析十進位字串，最多兩位小數
+func ParseDecimal(value string) (Decimal, error) {
+	return parseDecimal(value, false)
+}
+
+// MustParseDecimal 與 ParseDecimal 相同，解析失敗時 panic，用於常數
+func MustParseDecimal(value string) Decimal {
+	d, err := ParseDecimal(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// parseDecimal 解析十進位字串，round 為 true 時超過兩位的小數以四捨五入處理
+func parseDecimal(value string, round bool) (Decimal, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, value)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, value)
+	}
+
+	roundUp := false
+	if len(fracPart) > decimalScale {
+		if !round {
+			return Decimal{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidDecimal, value, decimalScale)
+		}
+		roundUp = fracPart[decimalScale] >= '5'
+		fracPart = fracPart[:decimalScale]
+	}
+	fracPart += strings.Repeat("0", decimalScale-len(fracPart))
+
+	cents, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, value)
+	}
+	if roundUp {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return Decimal{cents: cents}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cents 回傳以百分之一為單位的整數值
+func (d Decimal) Cents() int64 {
+	return d.cents
+}
+
+// IntPart 回傳整數部分 (捨去小數)
+func (d Decimal) IntPart() int64 {
+	return d.cents / 100
+}
+
+// Float64 回傳近似的浮點數，只用於顯示或記錄，不可再用於計算金額
+func (d Decimal) Float64() float64 {
+	return float64(d.cents) / 100
+}
+
+func (d Decimal) String() string {
+	sign := ""
+	cents := d.cents
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{cents: d.cents + o.cents}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{cents: d.cents - o.cents}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{cents: -d.cents}
+}
+
+// Mul 乘以整數，例如單價乘以數量
+func (d Decimal) Mul(n int64) Decimal {
+	return Decimal{cents: d.cents * n}
+}
+
+// MulDiv 計算 d * num / den，並以指定的模式捨入到兩位小數
+func (d Decimal) MulDiv(num, den int64, mode RoundingMode) Decimal {
+	if den == 0 {
+		return Decimal{}
+	}
+	n := new(big.Int).Mul(big.NewInt(d.cents), big.NewInt(num))
+	return Decimal{cents: divRound(n, big.NewInt(den), mode)}
+}
+
+// Percent 計算 d 的 p%，並以指定的模式捨入到兩位小數
+func (d Decimal) Percent(p Decimal, mode RoundingMode) Decimal {
+	// p 以百分之一為單位，因此除以 100 * 100
+	return d.MulDiv(p.cents, 10000, mode)
+}
+
+// MulRat 乘以有理數 (例如匯率)，並以指定的模式捨入到兩位小數
+func (d Decimal) MulRat(r *big.Rat, mode RoundingMode) Decimal {
+	n := new(big.Int).Mul(big.NewInt(d.cents), r.Num())
+	return Decimal{cents: divRound(n, r.Denom(), mode)}
+}
+
+// Ratio 計算 d * num / den，num 與 den 都是 Decimal，用於依金額比例分攤
+func (d Decimal) Ratio(num, den Decimal, mode RoundingMode) Decimal {
+	return d.MulDiv(num.cents, den.cents, mode)
+}
+
+// divRound 整數除法並依模式處理餘數
+func divRound(n, den *big.Int, mode RoundingMode) int64 {
+	if den.Sign() < 0 {
+		n = new(big.Int).Neg(n)
+		den = new(big.Int).Neg(den)
+	}
+	q, r := new(big.Int).QuoRem(n, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q.Int64()
+	}
+
+	// 比較 2|r| 與除數決定是否進位
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	cmp := twice.Cmp(den)
+	up := cmp > 0 || (cmp == 0 && (mode == RoundHalfUp || q.Bit(0) == 1))
+	if up {
+		if n.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
+
+// Cmp 比較大小，d < o 回傳 -1，相等回傳 0，d > o 回傳 1
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.cents < o.cents:
+		return -1
+	case d.cents > o.cents:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (d Decimal) LessThan(o Decimal) bool {
+	return d.cents < o.cents
+}
+
+func (d Decimal) GreaterThan(o Decimal) bool {
+	return d.cents > o.cents
+}
+
+func (d Decimal) IsZero() bool {
+	return d.cents == 0
+}
+
+func (d Decimal) IsPositive() bool {
+	return d.cents > 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.cents < 0
+}
+
+// MinDecimal 回傳較小的值
+func MinDecimal(a, b Decimal) Decimal {
+	if a.cents < b.cents {
+		return a
+	}
+	return b
+}
+
+// MaxDecimal 回傳較大的值
+func MaxDecimal(a, b Decimal) Decimal {
+	if a.cents > b.cents {
+		return a
+	}
+	return b
+}
+
+// MarshalJSON 輸出固定兩位小數的 JSON 數字，不經過 float64
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON 接受 JSON 數字或字串，直接以十進位解析
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	// 引號必須成對，避免 "12.5 之類的輸入被接受
+	if strings.HasPrefix(s, `"`) || strings.HasSuffix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidDecimal, s)
+		}
+		s = unquoted
+	}
+
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value 以十進位字串寫入資料庫
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan 讀取資料庫的數值，SQLite 的 decimal 欄位可能以整數或浮點數回傳
+func (d *Decimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case int64:
+		*d = NewDecimal(v)
+		return nil
+	case float64:
+		parsed, err := parseDecimal(strconv.FormatFloat(v, 'f', -1, 64), true)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	case []byte:
+		return d.scanString(string(v))
+	case string:
+		return d.scanString(v)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidDecimal, src)
+	}
+}
+
+func (d *Decimal) scanString(s string) error {
+	parsed, err := parseDecimal(s, true)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		round bool
+		cents int64
+		err   bool
+	}{
+		{name: "整數", value: "12", cents: 1200},
+		{name: "一位小數", value: "12.5", cents: 1250},
+		{name: "省略整數", value: ".5", cents: 50},
+		{name: "省略小數", value: "3.", cents: 300},
+		{name: "正號", value: "+1.25", cents: 125},
+		{name: "負數", value: "-1.25", cents: -125},
+		{name: "前後空白", value: " 7.10 ", cents: 710},
+		{name: "超過兩位小數", value: "1.005", err: true},
+		{name: "四捨五入進位", value: "1.005", round: true, cents: 101},
+		{name: "四捨五入捨去", value: "1.004", round: true, cents: 100},
+		{name: "進位到整數", value: "1.999", round: true, cents: 200},
+		{name: "負數遠離零進位", value: "-1.005", round: true, cents: -101},
+		{name: "空字串", value: "", err: true},
+		{name: "只有小數點", value: ".", err: true},
+		{name: "指數", value: "1e2", err: true},
+		{name: "非數字", value: "abc", err: true},
+		{name: "多個小數點", value: "1.2.3", err: true},
+		{name: "溢位", value: "999999999999999999999", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := parseDecimal(tt.value, tt.round)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidDecimal)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.cents, d.Cents())
+		})
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int64
+		den  int64
+		mode RoundingMode
+		want int64
+	}{
+		{name: "整除", n: 10, den: 2, mode: RoundHalfEven, want: 5},
+		{name: "不足一半捨去", n: 14, den: 10, mode: RoundHalfEven, want: 1},
+		{name: "超過一半進位", n: 16, den: 10, mode: RoundHalfEven, want: 2},
+		{name: "一半進位到偶數", n: 15, den: 10, mode: RoundHalfEven, want: 2},
+		{name: "一半捨去到偶數", n: 25, den: 10, mode: RoundHalfEven, want: 2},
+		{name: "一半四捨五入", n: 25, den: 10, mode: RoundHalfUp, want: 3},
+		{name: "負數一半捨去到偶數", n: -25, den: 10, mode: RoundHalfEven, want: -2},
+		{name: "負數一半進位到偶數", n: -15, den: 10, mode: RoundHalfEven, want: -2},
+		{name: "負數一半遠離零", n: -25, den: 10, mode: RoundHalfUp, want: -3},
+		{name: "負數超過一半", n: -16, den: 10, mode: RoundHalfEven, want: -2},
+		{name: "負除數", n: 25, den: -10, mode: RoundHalfUp, want: -3},
+		{name: "雙負數", n: -25, den: -10, mode: RoundHalfEven, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, divRound(big.NewInt(tt.n), big.NewInt(tt.den), tt.mode))
+		})
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   interface{}
+		cents int64
+		err   bool
+	}{
+		{name: "NULL", src: nil, cents: 0},
+		{name: "整數", src: int64(3), cents: 300},
+		{name: "浮點數", src: 12.5, cents: 1250},
+		{name: "浮點數誤差", src: 0.1 + 0.2, cents: 30},
+		{name: "浮點數超過兩位小數", src: 12.345, cents: 1235},
+		{name: "負浮點數", src: -0.5, cents: -50},
+		{name: "字串", src: "12.50", cents: 1250},
+		{name: "字串超過兩位小數", src: "0.125", cents: 13},
+		{name: "位元組", src: []byte("99.99"), cents: 9999},
+		{name: "無效字串", src: "abc", err: true},
+		{name: "不支援的型別", src: true, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DecimalFromCents(1)
+			err := d.Scan(tt.src)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidDecimal)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.cents, d.Cents())
+		})
+	}
+}
+
+func TestDecimalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		cents int64
+		err   bool
+	}{
+		{name: "數字", data: `12.5`, cents: 1250},
+		{name: "字串", data: `"12.5"`, cents: 1250},
+		{name: "負數", data: `-0.01`, cents: -1},
+		{name: "null 保留原值", data: `null`, cents: 1},
+		{name: "指數", data: `1e2`, err: true},
+		{name: "超過兩位小數", data: `1.005`, err: true},
+		{name: "空字串", data: `""`, err: true},
+		{name: "缺少結尾引號", data: `"12.5`, err: true},
+		{name: "缺少開頭引號", data: `12.5"`, err: true},
+		{name: "只有引號", data: `"`, err: true},
+		{name: "重複引號", data: `""12.5""`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DecimalFromCents(1)
+			err := d.UnmarshalJSON([]byte(tt.data))
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidDecimal)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.cents, d.Cents())
+		})
+	}
+
+	// 透過 encoding/json 解析時，格式錯誤的 JSON 在進入 UnmarshalJSON 前就會被拒絕
+	var body struct {
+		Price Decimal `json:"price"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"price": "19.90"}`), &body))
+	assert.Equal(t, MustParseDecimal("19.90"), body.Price)
+	assert.Error(t, json.Unmarshal([]byte(`{"price": 1e2}`), &body))
+}
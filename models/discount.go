@@ -8,13 +8,22 @@ import (
 type DiscountType string
 
 const (
-	Percentage DiscountType = "PERCENTAGE" // 百分比折扣
-	Fixed      DiscountType = "FIXED"      // 固定金額折扣
-	Threshold  DiscountType = "THRESHOLD"  // 滿額折扣
-	BOGO       DiscountType = "BOGO"       // 買一送一
-	MultiItem  DiscountType = "MULTI_ITEM" // 多件折扣
+	Percentage      DiscountType = "PERCENTAGE"       // 百分比折扣
+	Fixed           DiscountType = "FIXED"            // 固定金額折扣
+	Threshold       DiscountType = "THRESHOLD"        // 滿額折扣，設定 Tiers 時依消費級距折抵
+	BOGO            DiscountType = "BOGO"             // 買X送Y，規則見 BOGORule
+	MultiItem       DiscountType = "MULTI_ITEM"       // 多件折扣，設定 Tiers 時依數量級距計價
+	Bundle          DiscountType = "BUNDLE"           // 組合折扣，BundleItems 一起購買時以 BundlePrice 計價或折扣 Value%
+	FreeShipping    DiscountType = "FREE_SHIPPING"    // 免運費
+	ShippingPercent DiscountType = "SHIPPING_PERCENT" // 運費折扣 Value%
+	Gift            DiscountType = "GIFT"             // 滿額贈品，贈品為 Gift 的 DiscountProduct
 )
 
+// IsShipping 回傳是否為折抵運費的折扣類型
+func (t DiscountType) IsShipping() bool {
+	return t == FreeShipping || t == ShippingPercent
+}
+
 // 折扣條件類型
 type ConditionType string
 
@@ -34,19 +43,30 @@ const (
 )
 
 type Discount struct {
-	ID         int64            `json:"id" gorm:"primaryKey"`
-	Name       string           `json:"name" gorm:"size:255"`
-	Type       DiscountType     `json:"type" gorm:"size:50"`
-	Value      float64          `json:"value" gorm:"type:decimal(10,2)"`
-	StartDate  time.Time        `json:"start_date"`
-	EndDate    time.Time        `json:"end_date"`
-	Priority   DiscountPriority `json:"priority"`
-	Stackable  bool             `json:"stackable" gorm:"type:boolean"` // 是否可疊加
-	MaxUsage   int              `json:"max_usage"`                     // 最大使用次數
-	UsageCount int              `json:"usage_count"`                   // 已使用次數
-	CreatedAt  time.Time        `json:"created_at"`
-	UpdatedAt  time.Time        `json:"updated_at"`
-
-	Conditions []DiscountCondition `json:"conditions" gorm:"foreignKey:DiscountID"`
-	Products   []DiscountProduct   `json:"products" gorm:"foreignKey:DiscountID"`
+	ID              int64            `json:"id" gorm:"primaryKey"`
+	Name            string           `json:"name" gorm:"size:255"`
+	Type            DiscountType     `json:"type" gorm:"size:50"`
+	Value           Decimal          `json:"value" gorm:"type:decimal(10,2)"`
+	BundlePrice     Decimal          `json:"bundle_price" gorm:"type:decimal(10,2)"` // BUNDLE 每組的售價，0 時以 Value 為百分比折扣
+	MaxSavings      Decimal          `json:"max_savings" gorm:"type:decimal(10,2)"`  // 最高折抵金額，0 為不限
+	Currency        Currency         `json:"currency" gorm:"size:3"`                 // Value 與 CART_TOTAL 條件的貨幣
+	StartDate       time.Time        `json:"start_date"`
+	EndDate         time.Time        `json:"end_date"`
+	Priority        DiscountPriority `json:"priority"`
+	Stackable       bool             `json:"stackable" gorm:"type:boolean"`       // 是否可疊加
+	MaxUsage        int              `json:"max_usage"`                           // 最大使用次數
+	UsageCount      int              `json:"usage_count"`                         // 已使用次數
+	ReservedCount   int              `json:"reserved_count"`                      // 結帳中保留的次數，計入最大使用次數
+	MaxUsagePerUser int              `json:"max_usage_per_user"`                  // 每位用戶最大使用次數，0 為不限
+	RequiresCoupon  bool             `json:"requires_coupon" gorm:"type:boolean"` // 需輸入優惠碼才會套用
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+
+	Conditions     []DiscountCondition     `json:"conditions" gorm:"foreignKey:DiscountID"`
+	Products       []DiscountProduct       `json:"products" gorm:"foreignKey:DiscountID"`
+	Targets        []DiscountTarget        `json:"targets,omitempty" gorm:"foreignKey:DiscountID"`      // 依類別、品牌、標籤包含或排除商品
+	CurrencyValues []DiscountCurrencyValue `json:"currency_values" gorm:"foreignKey:DiscountID"`        // 各貨幣的金額與門檻
+	BundleItems    []BundleItem            `json:"bundle_items,omitempty" gorm:"foreignKey:DiscountID"` // BUNDLE 的組合內容
+	Tiers          []DiscountTier          `json:"tiers,omitempty" gorm:"foreignKey:DiscountID"`        // MULTI_ITEM、THRESHOLD 的階梯級距
+	BOGORule       *BOGORule               `json:"bogo_rule,omitempty" gorm:"foreignKey:DiscountID"`    // BOGO 折扣的規則，未設定時以 Value 為買N送N
 }
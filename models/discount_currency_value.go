@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// 折扣在特定貨幣下的金額與門檻，優先於匯率換算
+type DiscountCurrencyValue struct {
+	ID           int64     `json:"id" gorm:"primaryKey"`
+	DiscountID   int64     `json:"discount_id" gorm:"uniqueIndex:idx_discount_currency"`
+	Currency     Currency  `json:"currency" gorm:"size:3;uniqueIndex:idx_discount_currency"`
+	Amount       Decimal   `json:"amount" gorm:"type:decimal(10,2)"`         // FIXED、THRESHOLD 折扣的折抵金額，0 時由匯率換算
+	MaxSavings   Decimal   `json:"max_savings" gorm:"type:decimal(10,2)"`    // 最高折抵金額，0 時由匯率換算
+	MinCartTotal Decimal   `json:"min_cart_total" gorm:"type:decimal(10,2)"` // CART_TOTAL 條件的門檻，0 時由匯率換算
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
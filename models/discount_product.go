@@ -5,9 +5,13 @@ import (
 )
 
 type DiscountProduct struct {
-	ID         int64     `json:"id" gorm:"primaryKey"`
-	DiscountID int64     `json:"discount_id"`
-	ProductID  int64     `json:"product_id"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID           int64     `json:"id" gorm:"primaryKey"`
+	DiscountID   int64     `json:"discount_id"`
+	ProductID    int64     `json:"product_id"`
+	Exclude      bool      `json:"exclude" gorm:"type:boolean"` // 排除此商品
+	Gift         bool      `json:"gift" gorm:"type:boolean"`    // GIFT 折扣的贈品，不作為適用商品
+	GiftQuantity int       `json:"gift_quantity"`               // 每筆訂單贈送的件數，0 視為 1
+	GiftStock    int       `json:"gift_stock"`                  // 贈品剩餘庫存，用完時折扣不再適用
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// 折扣使用紀錄，結帳時每個套用的折扣寫入一筆，用於計算每位用戶的使用次數
+type DiscountRedemption struct {
+	ID             int64      `json:"id" gorm:"primaryKey"`
+	DiscountID     int64      `json:"discount_id" gorm:"index:idx_redemption_user_discount,priority:2"`
+	UserID         int64      `json:"user_id" gorm:"index:idx_redemption_user_discount,priority:1"`
+	OrderID        int64      `json:"order_id" gorm:"index"`
+	CouponID       int64      `json:"coupon_id,omitempty"` // 透過優惠碼套用時的優惠碼
+	AmountSaved    Decimal    `json:"amount_saved" gorm:"type:decimal(10,2)"`
+	ReversedAt     *time.Time `json:"reversed_at"` // 訂單取消或退款時沖銷，沖銷後不計入使用次數
+	ReversalReason string     `json:"reversal_reason,omitempty" gorm:"size:50"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
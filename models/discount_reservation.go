@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// 使用次數保留狀態
+type ReservationStatus string
+
+const (
+	ReservationHeld      ReservationStatus = "HELD"      // 結帳中，佔用一個使用名額
+	ReservationConfirmed ReservationStatus = "CONFIRMED" // 已付款，轉為正式使用次數
+	ReservationReleased  ReservationStatus = "RELEASED"  // 結帳取消，歸還名額
+	ReservationExpired   ReservationStatus = "EXPIRED"   // 逾時未付款，由 sweeper 歸還名額
+)
+
+// 結帳開始時為限量折扣保留的使用名額
+type DiscountReservation struct {
+	ID         int64             `json:"id" gorm:"primaryKey"`
+	DiscountID int64             `json:"discount_id" gorm:"index"`
+	CartID     int64             `json:"cart_id" gorm:"index"`
+	UserID     int64             `json:"user_id"`
+	Status     ReservationStatus `json:"status" gorm:"size:50;index"`
+	ExpiresAt  time.Time         `json:"expires_at" gorm:"index"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// 折扣適用範圍的維度
+type TargetType string
+
+const (
+	TargetCategory TargetType = "CATEGORY" // 商品類別
+	TargetBrand    TargetType = "BRAND"    // 品牌
+	TargetTag      TargetType = "TAG"      // 商品標籤，例如新品
+)
+
+// 以類別、品牌或標籤指定折扣的適用範圍。
+// 包含的規則 (與 DiscountProduct) 任一符合即適用，排除的規則任一符合即不適用
+type DiscountTarget struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	DiscountID int64      `json:"discount_id" gorm:"index"`
+	Type       TargetType `json:"type" gorm:"size:20"`
+	Value      string     `json:"value" gorm:"size:100"` // 不區分大小寫
+	Exclude    bool       `json:"exclude" gorm:"type:boolean"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
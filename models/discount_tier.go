@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// 階梯折扣的一個級距：MULTI_ITEM 依數量 (MinQuantity)，THRESHOLD 依消費金額 (MinSpend)
+// 達到多個級距時使用門檻最高的一個
+type DiscountTier struct {
+	ID          int64     `json:"id" gorm:"primaryKey"`
+	DiscountID  int64     `json:"discount_id" gorm:"index"`
+	MinQuantity int       `json:"min_quantity"`                        // MULTI_ITEM：適用商品的總件數門檻
+	MinSpend    Decimal   `json:"min_spend" gorm:"type:decimal(10,2)"` // THRESHOLD：適用商品的消費金額門檻
+	Percent     Decimal   `json:"percent" gorm:"type:decimal(5,2)"`    // MULTI_ITEM：所有適用商品的折扣百分比
+	Amount      Decimal   `json:"amount" gorm:"type:decimal(10,2)"`    // THRESHOLD：折抵金額
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 會員等級
+type MembershipTier string
+
+const (
+	MembershipRegular  MembershipTier = "REGULAR"  // 一般會員
+	MembershipSilver   MembershipTier = "SILVER"   // 銀卡會員
+	MembershipGold     MembershipTier = "GOLD"     // 金卡會員
+	MembershipPlatinum MembershipTier = "PLATINUM" // 白金會員
+)
+
+// 會員等級由低到高排列
+var membershipRanks = map[MembershipTier]int{
+	MembershipRegular:  1,
+	MembershipSilver:   2,
+	MembershipGold:     3,
+	MembershipPlatinum: 4,
+}
+
+// ParseMembershipTier 將條件值正規化為會員等級，忽略大小寫與空白
+func ParseMembershipTier(value string) (MembershipTier, bool) {
+	tier := MembershipTier(strings.ToUpper(strings.TrimSpace(value)))
+	_, ok := membershipRanks[tier]
+	return tier, ok
+}
+
+// Rank 回傳等級高低，未知等級 (包含訪客) 為 0
+func (t MembershipTier) Rank() int {
+	return membershipRanks[t]
+}
+
+// Satisfies 判斷此等級是否達到 required 等級，高等級會員也能享有低等級的優惠
+func (t MembershipTier) Satisfies(required MembershipTier) bool {
+	return t.Rank() > 0 && required.Rank() > 0 && t.Rank() >= required.Rank()
+}
+
+type UserMembership struct {
+	UserID    int64          `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Tier      MembershipTier `json:"tier" gorm:"size:50"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// 訂單狀態
+type OrderStatus string
+
+const (
+	OrderPlaced    OrderStatus = "PLACED"    // 已成立
+	OrderCancelled OrderStatus = "CANCELLED" // 已取消
+	OrderRefunded  OrderStatus = "REFUNDED"  // 已退款
+)
+
+// 結帳時凍結的購物車價格與折扣
+type Order struct {
+	ID               int64       `json:"id" gorm:"primaryKey"`
+	CartID           int64       `json:"cart_id" gorm:"uniqueIndex"`
+	UserID           int64       `json:"user_id" gorm:"index"`
+	Status           OrderStatus `json:"status" gorm:"size:50"`
+	Currency         Currency    `json:"currency" gorm:"size:3"`
+	Subtotal         Decimal     `json:"subtotal" gorm:"type:decimal(10,2)"`
+	ShippingFee      Decimal     `json:"shipping_fee" gorm:"type:decimal(10,2)"`
+	ShippingDiscount Decimal     `json:"shipping_discount" gorm:"type:decimal(10,2)"` // 運費折扣，已包含在 DiscountTotal
+	DiscountTotal    Decimal     `json:"discount_total" gorm:"type:decimal(10,2)"`
+	Total            Decimal     `json:"total" gorm:"type:decimal(10,2)"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+
+	Items     []OrderItem     `json:"items" gorm:"foreignKey:OrderID"`
+	Discounts []OrderDiscount `json:"discounts" gorm:"foreignKey:OrderID"`
+}
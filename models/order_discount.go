@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// 訂單實際套用的折扣
+type OrderDiscount struct {
+	ID           int64        `json:"id" gorm:"primaryKey"`
+	OrderID      int64        `json:"order_id" gorm:"index"`
+	DiscountID   int64        `json:"discount_id" gorm:"index"`
+	DiscountName string       `json:"discount_name" gorm:"size:255"`
+	Type         DiscountType `json:"type" gorm:"size:50"`
+	Amount       Decimal      `json:"amount" gorm:"type:decimal(10,2)"`
+	CouponCode   string       `json:"coupon_code,omitempty" gorm:"size:64"` // 透過優惠碼套用時的代碼
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+type OrderItem struct {
+	ID             int64     `json:"id" gorm:"primaryKey"`
+	OrderID        int64     `json:"order_id" gorm:"index"`
+	ProductID      int64     `json:"product_id"`
+	UnitPrice      Decimal   `json:"unit_price" gorm:"type:decimal(10,2)"`
+	Quantity       int       `json:"quantity"`
+	GiftDiscountID int64     `json:"gift_discount_id,omitempty"` // GIFT 折扣的贈品
+	Subtotal       Decimal   `json:"subtotal" gorm:"type:decimal(10,2)"`
+	DiscountTotal  Decimal   `json:"discount_total" gorm:"type:decimal(10,2)"`
+	Total          Decimal   `json:"total" gorm:"type:decimal(10,2)"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
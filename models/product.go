@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// 商品目錄，購物車與折扣計算以此為準，不採用客戶端提供的價格與類別
+type Product struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:255"`
+	Price     Decimal   `json:"price" gorm:"type:decimal(10,2)"`
+	Currency  Currency  `json:"currency" gorm:"size:3"` // 售價的貨幣
+	Category  string    `json:"category" gorm:"size:100"`
+	Brand     string    `json:"brand" gorm:"size:100"`
+	Tags      string    `json:"tags" gorm:"size:255"`             // 以逗號分隔
+	Active    bool      `json:"active" gorm:"type:boolean;index"` // 下架的商品不可加入購物車
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagList 回傳商品標籤
+func (p Product) TagList() []string {
+	return SplitTags(p.Tags)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"shopping_cart/models"
+)
+
+var ErrInvalidBOGORule = errors.New("invalid BOGO rule")
+
+// effectiveBOGORule 回傳折扣實際使用的規則，未設定規則時以 Value 為買N送N (預設買一送一)
+func effectiveBOGORule(discount *models.Discount) models.BOGORule {
+	if discount.BOGORule != nil {
+		rule := *discount.BOGORule
+		if rule.Mode == "" {
+			rule.Mode = models.BOGOSameItem
+		}
+		if !rule.GetPercent.IsPositive() {
+			rule.GetPercent = models.NewDecimal(100)
+		}
+		return rule
+	}
+
+	n := int(discount.Value.IntPart())
+	if n <= 0 {
+		n = 1
+	}
+	return models.BOGORule{Mode: models.BOGOSameItem, BuyQuantity: n, GetQuantity: n, GetPercent: models.NewDecimal(100)}
+}
+
+// validateBOGORule 檢查 BOGO 規則的參數
+func validateBOGORule(rule *models.BOGORule) error {
+	if rule == nil {
+		return nil
+	}
+	switch rule.Mode {
+	case "", models.BOGOSameItem, models.BOGOCheapest:
+	case models.BOGOCrossProduct:
+		if rule.GetProductID == 0 {
+			return fmt.Errorf("%w: cross product rule requires get_product_id", ErrInvalidBOGORule)
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidBOGORule, rule.Mode)
+	}
+	if rule.BuyQuantity <= 0 || rule.GetQuantity <= 0 {
+		return fmt.Errorf("%w: buy and get quantities must be positive", ErrInvalidBOGORule)
+	}
+	if rule.GetPercent.IsNegative() || rule.GetPercent.GreaterThan(models.NewDecimal(100)) {
+		return fmt.Errorf("%w: get percent must be between 0 and 100", ErrInvalidBOGORule)
+	}
+	return nil
+}
+
+// discountedUnits 計算 quantity 件中打折的件數：每 X+Y 件為一組，
+// 不足一組時超過 X 的部分也打折
+func discountedUnits(quantity int, rule models.BOGORule) int {
+	group := rule.BuyQuantity + rule.GetQuantity
+	return quantity/group*rule.GetQuantity + max(0, quantity%group-rule.BuyQuantity)
+}
+
+// bogoAmounts 依規則計算各明細的折抵金額
+func (e *PricingEngine) bogoAmounts(lines []LineBreakdown, eligible []int, discount *models.Discount, amounts map[int]models.Decimal) {
+	rule := effectiveBOGORule(discount)
+	units := make(map[int]int, len(eligible))
+
+	switch rule.Mode {
+	case models.BOGOSameItem:
+		for _, idx := range eligible {
+			units[idx] = discountedUnits(lines[idx].Quantity, rule)
+		}
+
+	case models.BOGOCheapest:
+		// 合併所有適用商品的件數，由最便宜的商品開始打折
+		total := 0
+		for _, idx := range eligible {
+			total += lines[idx].Quantity
+		}
+		remaining := discountedUnits(total, rule)
+
+		sorted := make([]int, len(eligible))
+		copy(sorted, eligible)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return lines[sorted[i]].UnitPrice.LessThan(lines[sorted[j]].UnitPrice)
+		})
+		for _, idx := range sorted {
+			if remaining == 0 {
+				break
+			}
+			n := min(remaining, lines[idx].Quantity)
+			units[idx] = n
+			remaining -= n
+		}
+
+	case models.BOGOCrossProduct:
+		// 每買 X 件適用商品，贈送商品 Y 件打折，以贈送商品在購物車中的數量為上限
+		bought := 0
+		for _, idx := range eligible {
+			if lines[idx].ProductID != rule.GetProductID {
+				bought += lines[idx].Quantity
+			}
+		}
+		remaining := bought / rule.BuyQuantity * rule.GetQuantity
+		for _, idx := range eligible {
+			if remaining == 0 {
+				break
+			}
+			if lines[idx].ProductID != rule.GetProductID {
+				continue
+			}
+			n := min(remaining, lines[idx].Quantity)
+			units[idx] = n
+			remaining -= n
+		}
+	}
+
+	for idx, n := range units {
+		if n > 0 {
+			amounts[idx] = lines[idx].UnitPrice.Mul(int64(n)).Percent(rule.GetPercent, e.rounding)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBOGORules(t *testing.T) {
+	engine := NewPricingEngine()
+
+	tests := []struct {
+		name     string
+		lines    []CartLine
+		discount models.Discount
+		amounts  []models.Decimal // 各明細的折抵金額
+	}{
+		{
+			name:     "未設定規則時以 Value 為買N送N",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 5}},
+			discount: models.Discount{ID: 1, Type: models.BOGO, Value: dec("2")},
+			amounts:  []models.Decimal{dec("200")}, // 買2送2：第3、4件免費，第5件原價
+		},
+		{
+			name:  "買3送1",
+			lines: []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 8}},
+			discount: models.Discount{ID: 1, Type: models.BOGO, BOGORule: &models.BOGORule{
+				BuyQuantity: 3, GetQuantity: 1,
+			}},
+			amounts: []models.Decimal{dec("200")},
+		},
+		{
+			name:  "買2件第3件5折",
+			lines: []CartLine{{ProductID: 1, UnitPrice: dec("99"), Quantity: 3}},
+			discount: models.Discount{ID: 1, Type: models.BOGO, BOGORule: &models.BOGORule{
+				BuyQuantity: 2, GetQuantity: 1, GetPercent: dec("50"),
+			}},
+			amounts: []models.Decimal{dec("49.5")},
+		},
+		{
+			name: "不同商品合併計算，最便宜的免費",
+			lines: []CartLine{
+				{ProductID: 1, UnitPrice: dec("300"), Quantity: 1},
+				{ProductID: 2, UnitPrice: dec("100"), Quantity: 1},
+				{ProductID: 3, UnitPrice: dec("200"), Quantity: 1},
+			},
+			discount: models.Discount{ID: 1, Type: models.BOGO, BOGORule: &models.BOGORule{
+				Mode: models.BOGOCheapest, BuyQuantity: 2, GetQuantity: 1,
+			}},
+			amounts: []models.Decimal{dec("0"), dec("100"), dec("0")},
+		},
+		{
+			name: "同一商品不合併計算",
+			lines: []CartLine{
+				{ProductID: 1, UnitPrice: dec("300"), Quantity: 1},
+				{ProductID: 2, UnitPrice: dec("100"), Quantity: 1},
+			},
+			discount: models.Discount{ID: 1, Type: models.BOGO, BOGORule: &models.BOGORule{
+				BuyQuantity: 1, GetQuantity: 1,
+			}},
+			amounts: []models.Decimal{dec("0"), dec("0")},
+		},
+		{
+			name: "買A送B",
+			lines: []CartLine{
+				{ProductID: 1, UnitPrice: dec("500"), Quantity: 2},
+				{ProductID: 2, UnitPrice: dec("80"), Quantity: 3},
+			},
+			discount: models.Discount{
+				ID:       1,
+				Type:     models.BOGO,
+				Products: []models.DiscountProduct{{ProductID: 1}},
+				BOGORule: &models.BOGORule{Mode: models.BOGOCrossProduct, BuyQuantity: 1, GetQuantity: 1, GetProductID: 2},
+			},
+			amounts: []models.Decimal{dec("0"), dec("160")}, // 買2件A，送2件B
+		},
+		{
+			name:  "買A送B但購物車沒有B",
+			lines: []CartLine{{ProductID: 1, UnitPrice: dec("500"), Quantity: 2}},
+			discount: models.Discount{
+				ID:       1,
+				Type:     models.BOGO,
+				Products: []models.DiscountProduct{{ProductID: 1}},
+				BOGORule: &models.BOGORule{Mode: models.BOGOCrossProduct, BuyQuantity: 1, GetQuantity: 1, GetProductID: 2},
+			},
+			amounts: []models.Decimal{dec("0")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.Calculate(tt.lines, []models.Discount{tt.discount})
+			for i, line := range result.Lines {
+				assert.Equal(t, tt.amounts[i], line.DiscountTotal)
+			}
+		})
+	}
+}
+
+func TestCreateDiscountWithBOGORule(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newDiscount := func(rule *models.BOGORule) *models.Discount {
+		return &models.Discount{
+			Name:      "Buy 3 Get 1",
+			Type:      models.BOGO,
+			StartDate: now.Add(-1 * time.Hour),
+			EndDate:   now.Add(24 * time.Hour),
+			BOGORule:  rule,
+		}
+	}
+
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(&models.BOGORule{BuyQuantity: 0, GetQuantity: 1})), ErrInvalidBOGORule)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(&models.BOGORule{BuyQuantity: 1, GetQuantity: 1, GetPercent: dec("150")})), ErrInvalidBOGORule)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(&models.BOGORule{Mode: models.BOGOCrossProduct, BuyQuantity: 1, GetQuantity: 1})), ErrInvalidBOGORule)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(&models.BOGORule{Mode: "RANDOM", BuyQuantity: 1, GetQuantity: 1})), ErrInvalidBOGORule)
+
+	// 規則與折扣一起儲存，套用時載入
+	assert.NoError(t, service.CreateDiscount(ctx, newDiscount(&models.BOGORule{BuyQuantity: 3, GetQuantity: 1})))
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 4}}
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, dec("100"), application.DiscountTotal)
+	assert.Equal(t, dec("300"), application.Total)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"shopping_cart/models"
+)
+
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// 組合配對時最多搜尋的節點數，避免大量組合時計算過久，超過時使用目前找到的最佳配對
+const maxBundlePackingNodes = 10000
+
+// 購物車缺少組合中的商品
+const reasonBundleIncomplete = "cart does not contain the full bundle"
+
+// validateBundle 檢查組合折扣的商品與價格
+func validateBundle(discount *models.Discount) error {
+	if discount.Type != models.Bundle {
+		if len(discount.BundleItems) > 0 {
+			return fmt.Errorf("%w: bundle items are only supported for %s discounts", ErrInvalidBundle, models.Bundle)
+		}
+		return nil
+	}
+
+	if len(discount.BundleItems) == 0 {
+		return fmt.Errorf("%w: at least one bundle item is required", ErrInvalidBundle)
+	}
+	seen := make(map[int64]bool, len(discount.BundleItems))
+	for _, item := range discount.BundleItems {
+		if item.ProductID == 0 || item.Quantity <= 0 {
+			return fmt.Errorf("%w: bundle items need a product and a positive quantity", ErrInvalidBundle)
+		}
+		if seen[item.ProductID] {
+			return fmt.Errorf("%w: duplicate product %d", ErrInvalidBundle, item.ProductID)
+		}
+		seen[item.ProductID] = true
+	}
+	if discount.BundlePrice.IsNegative() {
+		return fmt.Errorf("%w: bundle price cannot be negative", ErrInvalidBundle)
+	}
+	if discount.BundlePrice.IsZero() && (!discount.Value.IsPositive() || discount.Value.GreaterThan(models.NewDecimal(100))) {
+		return fmt.Errorf("%w: either a bundle price or a percentage between 0 and 100 is required", ErrInvalidBundle)
+	}
+	return nil
+}
+
+// 購物車中各商品的件數與單價
+type bundleStock struct {
+	units  map[int64]int
+	prices map[int64]models.Decimal
+}
+
+func newBundleStock(lines []LineBreakdown) bundleStock {
+	stock := bundleStock{units: make(map[int64]int, len(lines)), prices: make(map[int64]models.Decimal, len(lines))}
+	for _, line := range lines {
+		stock.units[line.ProductID] += line.Quantity
+		if _, ok := stock.prices[line.ProductID]; !ok {
+			stock.prices[line.ProductID] = line.UnitPrice
+		}
+	}
+	return stock
+}
+
+// bundleCount 回傳以 units 最多可以湊成幾組
+func bundleCount(items []models.BundleItem, units map[int64]int) int {
+	count := -1
+	for _, item := range items {
+		n := units[item.ProductID] / item.Quantity
+		if count < 0 || n < count {
+			count = n
+		}
+	}
+	return max(count, 0)
+}
+
+// bundleSavings 回傳一組的折抵金額
+func (e *PricingEngine) bundleSavings(discount *models.Discount, prices map[int64]models.Decimal) models.Decimal {
+	var value models.Decimal
+	for _, item := range discount.BundleItems {
+		value = value.Add(prices[item.ProductID].Mul(int64(item.Quantity)))
+	}
+	if discount.BundlePrice.IsPositive() {
+		return models.MaxDecimal(value.Sub(discount.BundlePrice), models.Decimal{})
+	}
+	return value.Percent(discount.Value, e.rounding)
+}
+
+// packBundles 在同一台購物車中為多個組合折扣分配商品，回傳每個折扣湊成的組數。
+// 同一件商品只能屬於一組，以分支定界搜尋總折抵金額最大的配對
+func (e *PricingEngine) packBundles(lines []LineBreakdown, discounts []models.Discount) map[int64]int {
+	stock := newBundleStock(lines)
+
+	type option struct {
+		discount *models.Discount
+		savings  models.Decimal
+	}
+	options := make([]option, 0, len(discounts))
+	for i := range discounts {
+		discount := &discounts[i]
+		if discount.Type != models.Bundle || len(discount.BundleItems) == 0 {
+			continue
+		}
+		savings := e.bundleSavings(discount, stock.prices)
+		if savings.IsPositive() && bundleCount(discount.BundleItems, stock.units) > 0 {
+			options = append(options, option{discount: discount, savings: savings})
+		}
+	}
+	if len(options) == 0 {
+		return nil
+	}
+
+	// 每組折抵較多的組合先搜尋，第一條路徑即為貪婪解
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].savings.GreaterThan(options[j].savings)
+	})
+
+	counts := make([]int, len(options))
+	best := make([]int, len(options))
+	var bestSavings models.Decimal
+	nodes := 0
+
+	var search func(i int, units map[int64]int, savings models.Decimal)
+	search = func(i int, units map[int64]int, savings models.Decimal) {
+		nodes++
+		if savings.GreaterThan(bestSavings) {
+			bestSavings = savings
+			copy(best, counts)
+		}
+		if i == len(options) || nodes > maxBundlePackingNodes {
+			return
+		}
+
+		// 剩餘的組合即使各自湊到最多組也無法超過目前最佳解時剪枝
+		bound := savings
+		for _, o := range options[i:] {
+			bound = bound.Add(o.savings.Mul(int64(bundleCount(o.discount.BundleItems, units))))
+		}
+		if !bound.GreaterThan(bestSavings) {
+			return
+		}
+
+		items := options[i].discount.BundleItems
+		for n := bundleCount(items, units); n >= 0; n-- {
+			for _, item := range items {
+				units[item.ProductID] -= n * item.Quantity
+			}
+			counts[i] = n
+			search(i+1, units, savings.Add(options[i].savings.Mul(int64(n))))
+			for _, item := range items {
+				units[item.ProductID] += n * item.Quantity
+			}
+		}
+		counts[i] = 0
+	}
+	search(0, stock.units, models.Decimal{})
+
+	packing := make(map[int64]int, len(options))
+	for i, o := range options {
+		if best[i] > 0 {
+			packing[o.discount.ID] = best[i]
+		}
+	}
+	return packing
+}
+
+// bundleAmounts 將 count 組的折抵金額依組合商品的金額比例分攤到各明細
+// consumed 記錄前面的組合已使用的件數，同一件商品不會被重複使用
+func (e *PricingEngine) bundleAmounts(lines []LineBreakdown, eligible []int, discount *models.Discount, count int, consumed map[int]int, amounts map[int]models.Decimal) {
+	if count == 0 {
+		return
+	}
+
+	needed := make(map[int64]int, len(discount.BundleItems))
+	for _, item := range discount.BundleItems {
+		needed[item.ProductID] = item.Quantity * count
+	}
+
+	used := make([]int, 0, len(eligible))
+	for _, idx := range eligible {
+		line := lines[idx]
+		n := min(needed[line.ProductID], line.Quantity-consumed[idx])
+		if n <= 0 {
+			continue
+		}
+		needed[line.ProductID] -= n
+		consumed[idx] += n
+		amounts[idx] = line.UnitPrice.Mul(int64(n))
+		used = append(used, idx)
+	}
+
+	stock := newBundleStock(lines)
+	savings := e.bundleSavings(discount, stock.prices).Mul(int64(count))
+	e.capAmounts(used, amounts, savings)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundlePricing(t *testing.T) {
+	engine := NewPricingEngine()
+
+	bundle := func(id int64, price models.Decimal, items ...models.BundleItem) models.Discount {
+		return models.Discount{ID: id, Type: models.Bundle, BundlePrice: price, Stackable: true, BundleItems: items}
+	}
+
+	t.Run("組合售價", func(t *testing.T) {
+		lines := []CartLine{
+			{ProductID: 1, UnitPrice: dec("80"), Quantity: 2},
+			{ProductID: 2, UnitPrice: dec("50"), Quantity: 1},
+		}
+		result := engine.Calculate(lines, []models.Discount{bundle(1, dec("100"), models.BundleItem{ProductID: 1, Quantity: 1}, models.BundleItem{ProductID: 2, Quantity: 1})})
+
+		// 只湊成一組：80 + 50 -> 100，多出的一件商品 1 原價
+		assert.Equal(t, dec("30"), result.TotalDiscount)
+		assert.Equal(t, dec("180"), result.Total)
+		assert.Equal(t, dec("18.46"), result.Lines[0].DiscountTotal) // 30 * 80 / 130
+		assert.Equal(t, dec("11.54"), result.Lines[1].DiscountTotal)
+	})
+
+	t.Run("組合百分比折扣與件數", func(t *testing.T) {
+		lines := []CartLine{
+			{ProductID: 1, UnitPrice: dec("100"), Quantity: 5},
+			{ProductID: 2, UnitPrice: dec("40"), Quantity: 3},
+		}
+		discount := models.Discount{ID: 1, Type: models.Bundle, Value: dec("10"), BundleItems: []models.BundleItem{
+			{ProductID: 1, Quantity: 2},
+			{ProductID: 2, Quantity: 1},
+		}}
+		result := engine.Calculate(lines, []models.Discount{discount})
+
+		// 兩組 (商品 1 四件、商品 2 兩件)，每組 240 折 24
+		assert.Equal(t, dec("48"), result.TotalDiscount)
+	})
+
+	t.Run("選擇總折抵最大的配對", func(t *testing.T) {
+		lines := []CartLine{
+			{ProductID: 1, UnitPrice: dec("100"), Quantity: 1},
+			{ProductID: 2, UnitPrice: dec("100"), Quantity: 1},
+			{ProductID: 3, UnitPrice: dec("100"), Quantity: 1},
+			{ProductID: 4, UnitPrice: dec("100"), Quantity: 1},
+		}
+		discounts := []models.Discount{
+			bundle(1, dec("150"), models.BundleItem{ProductID: 1, Quantity: 1}, models.BundleItem{ProductID: 2, Quantity: 1}),
+			bundle(2, dec("170"), models.BundleItem{ProductID: 1, Quantity: 1}, models.BundleItem{ProductID: 3, Quantity: 1}),
+			bundle(3, dec("170"), models.BundleItem{ProductID: 2, Quantity: 1}, models.BundleItem{ProductID: 4, Quantity: 1}),
+		}
+		result := engine.Calculate(lines, discounts)
+
+		// 單組折抵最多的 1+2 (50) 會佔用兩個組合都需要的商品，1+3 與 2+4 合計折抵 60
+		assert.Equal(t, dec("60"), result.TotalDiscount)
+		assert.Len(t, result.Rules, 2)
+		assert.Equal(t, int64(2), result.Rules[0].DiscountID)
+		assert.Equal(t, int64(3), result.Rules[1].DiscountID)
+	})
+}
+
+func TestApplyBundleDiscount(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newBundle := func(price models.Decimal, items ...models.BundleItem) *models.Discount {
+		return &models.Discount{
+			Name:        "Phone + Case",
+			Type:        models.Bundle,
+			BundlePrice: price,
+			StartDate:   now.Add(-1 * time.Hour),
+			EndDate:     now.Add(24 * time.Hour),
+			BundleItems: items,
+		}
+	}
+
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newBundle(dec("100"))), ErrInvalidBundle)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newBundle(dec("0"), models.BundleItem{ProductID: 1, Quantity: 1})), ErrInvalidBundle)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newBundle(dec("100"), models.BundleItem{ProductID: 1, Quantity: 1}, models.BundleItem{ProductID: 1, Quantity: 2})), ErrInvalidBundle)
+
+	assert.NoError(t, service.CreateDiscount(ctx, newBundle(dec("1000"),
+		models.BundleItem{ProductID: 1, Quantity: 1},
+		models.BundleItem{ProductID: 2, Quantity: 1},
+	)))
+
+	// 缺少組合中的商品
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: []CartLine{{ProductID: 1, UnitPrice: dec("900"), Quantity: 1}}})
+	assert.NoError(t, err)
+	assert.Empty(t, application.Applied)
+	assert.Equal(t, "cart does not contain the full bundle", application.Rejected[0].Reason)
+
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: []CartLine{
+		{ProductID: 1, UnitPrice: dec("900"), Quantity: 1},
+		{ProductID: 2, UnitPrice: dec("300"), Quantity: 1},
+		{ProductID: 3, UnitPrice: dec("50"), Quantity: 1},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, dec("200"), application.DiscountTotal)
+	assert.Equal(t, dec("1050"), application.Total)
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCartNotOpen        = errors.New("cart is not open")
+	ErrCartItemNotFound   = errors.New("cart item not found")
+	ErrInvalidQuantity    = errors.New("quantity must be greater than zero")
+	ErrInvalidUnitPrice   = errors.New("unit price cannot be negative")
+	ErrInvalidShippingFee = errors.New("shipping fee cannot be negative")
+	ErrCatalogFieldsSet   = errors.New("unit_price, category, brand and tags come from the product catalog")
+)
+
+// 加入購物車的商品
+type CartItemInput struct {
+	ProductID int64
+	UnitPrice models.Decimal
+	Quantity  int
+	Category  string
+	Brand     string
+	Tags      []string
+}
+
+type CartService struct {
+	db        *gorm.DB
+	discounts *DiscountService // 設定時商品異動後自動同步贈品
+	products  *ProductService  // 設定時商品的價格與類別以商品目錄為準
+}
+
+func NewCartService(db *gorm.DB) *CartService {
+	return &CartService{db: db}
+}
+
+// WithProductService 回傳以商品目錄決定加入商品的價格、類別、品牌與標籤的 CartService
+func (s *CartService) WithProductService(products *ProductService) *CartService {
+	clone := *s
+	clone.products = products
+	return &clone
+}
+
+func (s *CartService) CreateCart(ctx context.Context, userID int64) (*models.Cart, error) {
+	return s.CreateCartInCurrency(ctx, userID, models.DefaultCurrency)
+}
+
+// CreateCartInCurrency 建立以指定貨幣計價的購物車
+func (s *CartService) CreateCartInCurrency(ctx context.Context, userID int64, currency models.Currency) (*models.Cart, error) {
+	currency, err := models.ParseCurrency(string(currency))
+	if err != nil {
+		return nil, err
+	}
+
+	cart := &models.Cart{
+		UserID:    userID,
+		Currency:  currency,
+		Status:    models.CartOpen,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Items:     []models.CartItem{},
+		Coupons:   []models.CartCoupon{},
+	}
+
+	if err := s.db.WithContext(ctx).Create(cart).Error; err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+func (s *CartService) GetCart(ctx context.Context, id int64) (*models.Cart, error) {
+	cart := &models.Cart{}
+	err := s.db.WithContext(ctx).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Coupons", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(cart, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	cart.Subtotal = CalculateSubtotal(cart)
+	return cart, nil
+}
+
+// AddItem 將商品加入購物車，已存在的商品會累加數量並更新單價與類別
+// 設定商品目錄時價格、類別、品牌與標籤以目錄為準，input 不可再提供這些欄位
+func (s *CartService) AddItem(ctx context.Context, cartID int64, input CartItemInput) (*models.Cart, error) {
+	if input.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	if input.UnitPrice.IsNegative() {
+		return nil, ErrInvalidUnitPrice
+	}
+	if s.products != nil && (!input.UnitPrice.IsZero() || input.Category != "" || input.Brand != "" || len(input.Tags) > 0) {
+		return nil, ErrCatalogFieldsSet
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.ensureOpen(tx, cartID); err != nil {
+			return err
+		}
+		if s.products != nil {
+			var err error
+			if input, err = s.catalogItem(ctx, tx, cartID, input); err != nil {
+				return err
+			}
+		}
+
+		var item models.CartItem
+		err := tx.Where("cart_id = ? AND product_id = ? AND gift_discount_id = 0", cartID, input.ProductID).First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			item = models.CartItem{
+				CartID:    cartID,
+				ProductID: input.ProductID,
+				UnitPrice: input.UnitPrice,
+				Quantity:  input.Quantity,
+				Category:  input.Category,
+				Brand:     input.Brand,
+				Tags:      models.JoinTags(input.Tags),
+			}
+			return tx.Create(&item).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&item).Updates(map[string]interface{}{
+			"unit_price": input.UnitPrice,
+			"quantity":   item.Quantity + input.Quantity,
+			"category":   input.Category,
+			"brand":      input.Brand,
+			"tags":       models.JoinTags(input.Tags),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SyncGifts(ctx, cartID); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, cartID)
+}
+
+// UpdateItemQuantity 更新商品數量，數量為 0 時移除該商品
+func (s *CartService) UpdateItemQuantity(ctx context.Context, cartID, productID int64, quantity int) (*models.Cart, error) {
+	if quantity < 0 {
+		return nil, ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		if err := s.RemoveItem(ctx, cartID, productID); err != nil {
+			return nil, err
+		}
+		return s.GetCart(ctx, cartID)
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.ensureOpen(tx, cartID); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.CartItem{}).
+			Where("cart_id = ? AND product_id = ? AND gift_discount_id = 0", cartID, productID).
+			Update("quantity", quantity)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCartItemNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SyncGifts(ctx, cartID); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, cartID)
+}
+
+func (s *CartService) RemoveItem(ctx context.Context, cartID, productID int64) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.ensureOpen(tx, cartID); err != nil {
+			return err
+		}
+
+		result := tx.Where("cart_id = ? AND product_id = ? AND gift_discount_id = 0", cartID, productID).Delete(&models.CartItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCartItemNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.SyncGifts(ctx, cartID)
+}
+
+// SetShippingFee 設定購物車的運費
+func (s *CartService) SetShippingFee(ctx context.Context, cartID int64, fee models.Decimal) (*models.Cart, error) {
+	if fee.IsNegative() {
+		return nil, ErrInvalidShippingFee
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.ensureOpen(tx, cartID); err != nil {
+			return err
+		}
+		return tx.Model(&models.Cart{}).Where("id = ?", cartID).Updates(map[string]interface{}{
+			"shipping_fee": fee,
+			"updated_at":   time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SyncGifts(ctx, cartID); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, cartID)
+}
+
+// catalogItem 以商品目錄的內容取代加入的商品，只保留商品與數量
+func (s *CartService) catalogItem(ctx context.Context, tx *gorm.DB, cartID int64, input CartItemInput) (CartItemInput, error) {
+	var cart models.Cart
+	if err := tx.Select("currency").First(&cart, cartID).Error; err != nil {
+		return input, err
+	}
+
+	lines, err := s.products.WithTx(tx).CatalogLines(ctx, []CartLine{{ProductID: input.ProductID, Quantity: input.Quantity}}, cart.Currency)
+	if err != nil {
+		return input, err
+	}
+	return CartItemInput{
+		ProductID: input.ProductID,
+		UnitPrice: lines[0].UnitPrice,
+		Quantity:  input.Quantity,
+		Category:  lines[0].Category,
+		Brand:     lines[0].Brand,
+		Tags:      lines[0].Tags,
+	}, nil
+}
+
+// ensureOpen 確認購物車存在且仍可修改
+func (s *CartService) ensureOpen(tx *gorm.DB, cartID int64) error {
+	var cart models.Cart
+	if err := tx.First(&cart, cartID).Error; err != nil {
+		return err
+	}
+	if cart.Status != models.CartOpen {
+		return ErrCartNotOpen
+	}
+	return nil
+}
+
+// CalculateSubtotal 計算購物車未折扣前的小計
+func CalculateSubtotal(cart *models.Cart) models.Decimal {
+	var subtotal models.Decimal
+	for _, item := range cart.Items {
+		subtotal = subtotal.Add(item.UnitPrice.Mul(int64(item.Quantity)))
+	}
+	return subtotal
+}
+
+// PricedLines 回傳購物車計價用的明細，設定商品目錄時以目錄目前的售價、類別、品牌與標籤為準，
+// 已下架或不存在的商品會回傳錯誤
+func (s *CartService) PricedLines(ctx context.Context, cart *models.Cart) ([]CartLine, error) {
+	lines := CartLines(cart)
+	if s.products == nil {
+		return lines, nil
+	}
+	return s.products.CatalogLines(ctx, lines, cart.Currency)
+}
+
+// CartLines 將購物車商品轉換為計價引擎使用的明細
+// GIFT 折扣加入的贈品由計價引擎依折扣重新產生，不列入明細
+func CartLines(cart *models.Cart) []CartLine {
+	lines := make([]CartLine, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		if item.GiftDiscountID != 0 {
+			continue
+		}
+		lines = append(lines, CartLine{
+			ProductID: item.ProductID,
+			UnitPrice: item.UnitPrice,
+			Quantity:  item.Quantity,
+			Category:  item.Category,
+			Brand:     item.Brand,
+			Tags:      item.TagList(),
+		})
+	}
+	return lines
+}
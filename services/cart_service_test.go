@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCartItems(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewCartService(db)
+	ctx := context.Background()
+
+	cart, err := service.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	assert.NotZero(t, cart.ID)
+	assert.Equal(t, models.CartOpen, cart.Status)
+
+	// 加入商品
+	cart, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 100, UnitPrice: dec("50"), Quantity: 2})
+	assert.NoError(t, err)
+	cart, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 200, UnitPrice: dec("120.5"), Quantity: 1})
+	assert.NoError(t, err)
+	assert.Len(t, cart.Items, 2)
+	assert.Equal(t, dec("220.5"), cart.Subtotal)
+
+	// 重複加入同一商品會累加數量
+	cart, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 100, UnitPrice: dec("50"), Quantity: 1})
+	assert.NoError(t, err)
+	assert.Len(t, cart.Items, 2)
+	assert.Equal(t, 3, cart.Items[0].Quantity)
+	assert.Equal(t, dec("270.5"), cart.Subtotal)
+
+	// 更新數量
+	cart, err = service.UpdateItemQuantity(ctx, cart.ID, 200, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cart.Items[1].Quantity)
+	assert.Equal(t, dec("632"), cart.Subtotal)
+
+	// 數量為 0 時移除商品
+	cart, err = service.UpdateItemQuantity(ctx, cart.ID, 100, 0)
+	assert.NoError(t, err)
+	assert.Len(t, cart.Items, 1)
+	assert.Equal(t, dec("482"), cart.Subtotal)
+
+	// 移除商品
+	err = service.RemoveItem(ctx, cart.ID, 200)
+	assert.NoError(t, err)
+	cart, err = service.GetCart(ctx, cart.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, cart.Items)
+	assert.Equal(t, dec("0"), cart.Subtotal)
+
+	// 移除不存在的商品
+	err = service.RemoveItem(ctx, cart.ID, 200)
+	assert.ErrorIs(t, err, ErrCartItemNotFound)
+}
+
+func TestCartItemValidation(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewCartService(db)
+	ctx := context.Background()
+
+	cart, err := service.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 100, UnitPrice: dec("50"), Quantity: 0})
+	assert.ErrorIs(t, err, ErrInvalidQuantity)
+
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 100, UnitPrice: dec("-1"), Quantity: 1})
+	assert.ErrorIs(t, err, ErrInvalidUnitPrice)
+
+	// 已結帳的購物車不可修改
+	db.Model(&models.Cart{}).Where("id = ?", cart.ID).Update("status", models.CartCheckedOut)
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 100, UnitPrice: dec("50"), Quantity: 1})
+	assert.ErrorIs(t, err, ErrCartNotOpen)
+}
+
+func TestCartLines(t *testing.T) {
+	cart := &models.Cart{
+		Items: []models.CartItem{
+			{ProductID: 1, UnitPrice: dec("100"), Quantity: 2},
+			{ProductID: 2, UnitPrice: dec("25.5"), Quantity: 1},
+		},
+	}
+
+	lines := CartLines(cart)
+	assert.Equal(t, []CartLine{
+		{ProductID: 1, UnitPrice: dec("100"), Quantity: 2},
+		{ProductID: 2, UnitPrice: dec("25.5"), Quantity: 1},
+	}, lines)
+	assert.Equal(t, dec("225.5"), CalculateSubtotal(cart))
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCartEmpty               = errors.New("cart is empty")
+	ErrAppliedDiscountsChanged = errors.New("applied discounts have changed")
+	ErrOrderNotReversible      = errors.New("only placed orders can be cancelled or refunded")
+	ErrExpectedDiscountsNeeded = errors.New("expected discount ids are required, send an empty list when no discounts are shown")
+)
+
+// 結帳的輸入
+type CheckoutInput struct {
+	CartID int64
+	// 用戶在購物車看到的折扣，若其中有折扣已無法套用則結帳失敗，避免價格在付款時被默默更改。
+	// 必須提供，沒有折扣時為空陣列
+	ExpectedDiscountIDs []int64
+	Strategy            StackingStrategy // 需與購物車顯示折扣時的策略相同
+}
+
+// 預設的折扣保留時間
+const defaultReservationTTL = 15 * time.Minute
+
+// 開始結帳後的報價與保留的折扣名額
+type CheckoutSession struct {
+	Application  *DiscountApplication         `json:"application"`
+	Reservations []models.DiscountReservation `json:"reservations"`
+	ExpiresAt    time.Time                    `json:"expires_at"`
+}
+
+type CheckoutService struct {
+	db              *gorm.DB
+	discountService *DiscountService
+	products        *ProductService // 設定時以商品目錄目前的售價結帳
+	reservationTTL  time.Duration
+}
+
+func NewCheckoutService(db *gorm.DB, discountService *DiscountService) *CheckoutService {
+	return &CheckoutService{db: db, discountService: discountService, reservationTTL: defaultReservationTTL}
+}
+
+// WithReservationTTL 回傳使用指定保留時間的 CheckoutService
+func (s *CheckoutService) WithReservationTTL(ttl time.Duration) *CheckoutService {
+	clone := *s
+	clone.reservationTTL = ttl
+	return &clone
+}
+
+// WithProductService 回傳以商品目錄目前的售價、類別、品牌與標籤結帳的 CheckoutService
+func (s *CheckoutService) WithProductService(products *ProductService) *CheckoutService {
+	clone := *s
+	clone.products = products
+	return &clone
+}
+
+// 購物車在交易中的報價
+type checkoutQuote struct {
+	cart        *models.Cart
+	coupons     []models.Coupon
+	application *DiscountApplication
+}
+
+// StartCheckout 計算購物車價格並為套用的限量折扣保留名額，直到付款或逾時為止
+func (s *CheckoutService) StartCheckout(ctx context.Context, input CheckoutInput) (*CheckoutSession, error) {
+	var session *CheckoutSession
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		quote, err := s.quote(ctx, tx, input)
+		if err != nil {
+			return err
+		}
+
+		reservations, err := s.discountService.WithTx(tx).ReserveDiscounts(ctx, quote.cart.ID, quote.cart.UserID, appliedDiscountIDs(quote.application), s.reservationTTL)
+		if err != nil {
+			return err
+		}
+
+		session = &CheckoutSession{
+			Application:  quote.application,
+			Reservations: reservations,
+			ExpiresAt:    time.Now().Add(s.reservationTTL),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// CancelCheckout 放棄結帳並釋放保留的折扣名額
+func (s *CheckoutService) CancelCheckout(ctx context.Context, cartID int64) error {
+	return s.discountService.ReleaseReservations(ctx, cartID)
+}
+
+// Checkout 在同一個交易中凍結購物車價格、建立訂單並更新折扣使用次數。
+// 開始結帳時保留的名額會轉為使用次數，未保留的折扣則直接遞增
+func (s *CheckoutService) Checkout(ctx context.Context, input CheckoutInput) (*models.Order, error) {
+	var order *models.Order
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		quote, err := s.quote(ctx, tx, input)
+		if err != nil {
+			return err
+		}
+		cart, application, coupons := quote.cart, quote.application, quote.coupons
+
+		order = buildOrder(cart, application, coupons)
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+
+		discountService := s.discountService.WithTx(tx)
+		discountIDs := appliedDiscountIDs(application)
+		confirmed, err := discountService.ConfirmReservations(ctx, cart.ID, discountIDs)
+		if err != nil {
+			return err
+		}
+		if err := discountService.UpdateDiscountUsage(ctx, withoutIDs(discountIDs, confirmed)); err != nil {
+			return err
+		}
+		if err := discountService.ConsumeGiftStock(ctx, order.Items); err != nil {
+			return err
+		}
+		redemptions := buildRedemptions(cart, order, coupons)
+		if err := discountService.RecordRedemptions(ctx, redemptions); err != nil {
+			return err
+		}
+		couponIDs := make([]int64, 0, len(redemptions))
+		for _, redemption := range redemptions {
+			if redemption.CouponID != 0 {
+				couponIDs = append(couponIDs, redemption.CouponID)
+			}
+		}
+		if err := NewCouponService(tx).RedeemCoupons(ctx, couponIDs); err != nil {
+			return err
+		}
+
+		// 以狀態作為條件，避免同一台購物車被重複結帳
+		result := tx.Model(&models.Cart{}).
+			Where("id = ? AND status = ?", cart.ID, models.CartOpen).
+			Updates(map[string]interface{}{"status": models.CartCheckedOut, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCartNotOpen
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// quote 在交易中載入購物車並計算折扣，確認用戶看到的折扣仍然適用
+func (s *CheckoutService) quote(ctx context.Context, tx *gorm.DB, input CheckoutInput) (*checkoutQuote, error) {
+	cart := &models.Cart{}
+	err := tx.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Coupons").
+		First(cart, input.CartID).Error
+	if err != nil {
+		return nil, err
+	}
+	if cart.Status != models.CartOpen {
+		return nil, ErrCartNotOpen
+	}
+	lines := CartLines(cart)
+	if len(lines) == 0 {
+		return nil, ErrCartEmpty
+	}
+	if input.ExpectedDiscountIDs == nil {
+		return nil, ErrExpectedDiscountsNeeded
+	}
+	// 加入購物車後售價可能已變動或商品已下架
+	if s.products != nil {
+		if lines, err = s.products.WithTx(tx).CatalogLines(ctx, lines, cart.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	coupons, err := NewCouponService(tx).CartCoupons(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+
+	application, err := s.discountService.WithTx(tx).ApplyDiscounts(ctx, ApplyDiscountInput{
+		CartID:      cart.ID,
+		UserID:      cart.UserID, // 會員等級與使用上限一律以購物車的用戶為準
+		Lines:       lines,
+		Strategy:    input.Strategy,
+		Coupons:     coupons,
+		Currency:    cart.Currency,
+		ShippingFee: cart.ShippingFee,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExpectedDiscounts(application, input.ExpectedDiscountIDs); err != nil {
+		return nil, err
+	}
+
+	return &checkoutQuote{cart: cart, coupons: coupons, application: application}, nil
+}
+
+func (s *CheckoutService) GetOrder(ctx context.Context, id int64) (*models.Order, error) {
+	order := &models.Order{}
+	err := s.db.WithContext(ctx).
+		Preload("Items").
+		Preload("Discounts").
+		First(order, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelOrder 取消訂單並歸還折扣使用次數與贈品庫存
+func (s *CheckoutService) CancelOrder(ctx context.Context, id int64) (*models.Order, error) {
+	return s.reverseOrder(ctx, id, models.OrderCancelled)
+}
+
+// RefundOrder 將訂單標記為退款並歸還折扣使用次數
+func (s *CheckoutService) RefundOrder(ctx context.Context, id int64) (*models.Order, error) {
+	return s.reverseOrder(ctx, id, models.OrderRefunded)
+}
+
+func (s *CheckoutService) reverseOrder(ctx context.Context, id int64, status models.OrderStatus) (*models.Order, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		order := &models.Order{}
+		if err := tx.Preload("Items").First(order, id).Error; err != nil {
+			return err
+		}
+
+		// 以狀態作為條件，避免同一筆訂單被重複沖銷
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", id, models.OrderPlaced).
+			Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderNotReversible
+		}
+
+		discountService := s.discountService.WithTx(tx)
+		if _, err := discountService.ReverseRedemptions(ctx, id, string(status)); err != nil {
+			return err
+		}
+		return discountService.RestoreGiftStock(ctx, order.Items)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetOrder(ctx, id)
+}
+
+// checkExpectedDiscounts 確認用戶看到的折扣都仍被套用
+func checkExpectedDiscounts(application *DiscountApplication, expectedIDs []int64) error {
+	applied := make(map[int64]bool, len(application.Applied))
+	for _, rule := range application.Applied {
+		applied[rule.DiscountID] = true
+	}
+
+	for _, id := range expectedIDs {
+		if applied[id] {
+			continue
+		}
+		for _, r := range application.Rejected {
+			if r.DiscountID != id {
+				continue
+			}
+			switch r.Reason {
+			case reasonUsageLimitReached:
+				return &DiscountExhaustedError{DiscountIDs: []int64{id}}
+			case reasonUserLimitReached:
+				return fmt.Errorf("%w: discount %d", ErrDiscountUserLimitExceeded, id)
+			}
+		}
+		return fmt.Errorf("%w: discount %d is no longer applied", ErrAppliedDiscountsChanged, id)
+	}
+	return nil
+}
+
+func appliedDiscountIDs(application *DiscountApplication) []int64 {
+	ids := make([]int64, len(application.Applied))
+	for i, rule := range application.Applied {
+		ids[i] = rule.DiscountID
+	}
+	return ids
+}
+
+// withoutIDs 回傳不在 excluded 中的ID
+func withoutIDs(ids, excluded []int64) []int64 {
+	skip := make(map[int64]bool, len(excluded))
+	for _, id := range excluded {
+		skip[id] = true
+	}
+
+	remaining := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !skip[id] {
+			remaining = append(remaining, id)
+		}
+	}
+	return remaining
+}
+
+// buildRedemptions 為訂單套用的折扣建立使用紀錄，個人使用次數一律記在購物車的用戶
+func buildRedemptions(cart *models.Cart, order *models.Order, coupons []models.Coupon) []models.DiscountRedemption {
+	byDiscount := make(map[int64]int64, len(coupons))
+	for _, coupon := range coupons {
+		byDiscount[coupon.DiscountID] = coupon.ID
+	}
+
+	redemptions := make([]models.DiscountRedemption, len(order.Discounts))
+	for i, discount := range order.Discounts {
+		redemptions[i] = models.DiscountRedemption{
+			DiscountID:  discount.DiscountID,
+			UserID:      cart.UserID,
+			OrderID:     order.ID,
+			CouponID:    byDiscount[discount.DiscountID],
+			AmountSaved: discount.Amount,
+		}
+	}
+	return redemptions
+}
+
+func buildOrder(cart *models.Cart, application *DiscountApplication, coupons []models.Coupon) *models.Order {
+	now := time.Now()
+	order := &models.Order{
+		CartID:           cart.ID,
+		UserID:           cart.UserID,
+		Status:           models.OrderPlaced,
+		Currency:         application.Currency,
+		Subtotal:         application.Subtotal,
+		ShippingFee:      application.ShippingFee,
+		ShippingDiscount: application.ShippingDiscount,
+		DiscountTotal:    application.DiscountTotal,
+		Total:            application.Total,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Items:            make([]models.OrderItem, len(application.Lines)),
+		Discounts:        make([]models.OrderDiscount, len(application.Applied)),
+	}
+
+	for i, line := range application.Lines {
+		order.Items[i] = models.OrderItem{
+			ProductID:      line.ProductID,
+			UnitPrice:      line.UnitPrice,
+			Quantity:       line.Quantity,
+			GiftDiscountID: line.GiftDiscountID,
+			Subtotal:       line.Subtotal,
+			DiscountTotal:  line.DiscountTotal,
+			Total:          line.Total,
+		}
+	}
+	codes := make(map[int64]string, len(coupons))
+	for _, coupon := range coupons {
+		codes[coupon.DiscountID] = coupon.Code
+	}
+	for i, rule := range application.Applied {
+		order.Discounts[i] = models.OrderDiscount{
+			DiscountID:   rule.DiscountID,
+			DiscountName: rule.DiscountName,
+			Type:         rule.Type,
+			Amount:       rule.Amount,
+			CouponCode:   codes[rule.DiscountID],
+		}
+	}
+
+	return order
+}
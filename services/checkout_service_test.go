@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckout(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:      "10% Off",
+		Type:      models.Percentage,
+		Value:     dec("10"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		MaxUsage:  5,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	cart, err := cartService.CreateCart(ctx, 7)
+	assert.NoError(t, err)
+	_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 2})
+	assert.NoError(t, err)
+	_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 2, UnitPrice: dec("50"), Quantity: 1})
+	assert.NoError(t, err)
+
+	order, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.NoError(t, err)
+	assert.NotZero(t, order.ID)
+	assert.Equal(t, int64(7), order.UserID)
+	assert.Equal(t, dec("250"), order.Subtotal)
+	assert.Equal(t, dec("25"), order.DiscountTotal)
+	assert.Equal(t, dec("225"), order.Total)
+
+	// 訂單保存明細與折扣
+	saved, err := checkoutService.GetOrder(ctx, order.ID)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Items, 2)
+	assert.Equal(t, dec("180"), saved.Items[0].Total)
+	assert.Len(t, saved.Discounts, 1)
+	assert.Equal(t, discount.ID, saved.Discounts[0].DiscountID)
+	assert.Equal(t, dec("25"), saved.Discounts[0].Amount)
+
+	// 使用次數於結帳時更新
+	var updated models.Discount
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 1, updated.UsageCount)
+
+	// 購物車已結帳，不可重複結帳或修改
+	cart, err = cartService.GetCart(ctx, cart.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CartCheckedOut, cart.Status)
+
+	_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID})
+	assert.ErrorIs(t, err, ErrCartNotOpen)
+
+	_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+	assert.ErrorIs(t, err, ErrCartNotOpen)
+}
+
+func TestCheckoutFailsWhenDiscountExhausted(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:      "Limited 50 Off",
+		Type:      models.Fixed,
+		Value:     dec("50"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		MaxUsage:  1,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	// 兩台購物車在購物期間都看到同一個限量折扣
+	first, _ := cartService.CreateCart(ctx, 1)
+	second, _ := cartService.CreateCart(ctx, 2)
+	for _, cart := range []*models.Cart{first, second} {
+		_, err := cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("200"), Quantity: 1})
+		assert.NoError(t, err)
+
+		application, err := discountService.ApplyDiscounts(ctx, ApplyDiscountInput{CartID: cart.ID, Lines: []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}}})
+		assert.NoError(t, err)
+		assert.Len(t, application.Applied, 1)
+	}
+
+	_, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: first.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.NoError(t, err)
+
+	// 第二台購物車結帳時折扣已用完，結帳失敗且不建立訂單
+	_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: second.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.ErrorIs(t, err, ErrDiscountUsageExceeded)
+
+	var orderCount int64
+	db.Model(&models.Order{}).Count(&orderCount)
+	assert.Equal(t, int64(1), orderCount)
+
+	cart, err := cartService.GetCart(ctx, second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CartOpen, cart.Status)
+
+	var updated models.Discount
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 1, updated.UsageCount)
+
+	// 使用次數已達上限時直接更新也會失敗
+	err = discountService.UpdateDiscountUsage(ctx, []int64{discount.ID})
+	assert.ErrorIs(t, err, ErrDiscountUsageExceeded)
+}
+
+func TestCheckoutEmptyCart(t *testing.T) {
+	db := setupTestDB(t)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, NewDiscountService(db))
+	ctx := context.Background()
+
+	cart, err := cartService.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+
+	_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID})
+	assert.ErrorIs(t, err, ErrCartEmpty)
+}
+
+func TestCheckoutWithShipping(t *testing.T) {
+	db := setupTestDB(t)
+	cartService := NewCartService(db)
+	discountService := NewDiscountService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	freeShipping := &models.Discount{
+		Name:      "Free Shipping",
+		Type:      models.FreeShipping,
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, freeShipping))
+
+	cart, err := cartService.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("300"), Quantity: 1})
+	assert.NoError(t, err)
+
+	_, err = cartService.SetShippingFee(ctx, cart.ID, dec("-1"))
+	assert.ErrorIs(t, err, ErrInvalidShippingFee)
+	cart, err = cartService.SetShippingFee(ctx, cart.ID, dec("60"))
+	assert.NoError(t, err)
+	assert.Equal(t, dec("60"), cart.ShippingFee)
+
+	// 未提供用戶看到的折扣時不可結帳
+	_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID})
+	assert.ErrorIs(t, err, ErrExpectedDiscountsNeeded)
+
+	order, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{freeShipping.ID}})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("60"), order.ShippingFee)
+	assert.Equal(t, dec("60"), order.ShippingDiscount)
+	assert.Equal(t, dec("60"), order.DiscountTotal)
+	assert.Equal(t, dec("300"), order.Total)
+}
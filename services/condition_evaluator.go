@@ -0,0 +1,151 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"shopping_cart/models"
+)
+
+// 評估折扣條件時的購物車狀態
+type EvaluationContext struct {
+	Tier      models.MembershipTier
+	CartTotal models.Decimal
+	Lines     []CartLine
+	// 已輸入優惠碼的折扣，需要優惠碼的折扣只有在此集合中才適用
+	CouponDiscountIDs map[int64]bool
+	UserID            int64
+	Redemptions       map[int64]int  // 用戶各折扣已使用的次數
+	HeldDiscountIDs   map[int64]bool // 購物車已保留名額的折扣
+}
+
+// 單一條件的評估結果
+type ConditionResult struct {
+	ConditionID int64                `json:"condition_id"`
+	Type        models.ConditionType `json:"type"`
+	Value       string               `json:"value"`
+	Passed      bool                 `json:"passed"`
+	Reason      string               `json:"reason,omitempty"`
+}
+
+type ConditionEvaluator struct{}
+
+func NewConditionEvaluator() *ConditionEvaluator {
+	return &ConditionEvaluator{}
+}
+
+// Evaluate 逐一評估折扣的所有條件並回傳每個條件的結果
+func (e *ConditionEvaluator) Evaluate(discount *models.Discount, ec EvaluationContext) []ConditionResult {
+	results := make([]ConditionResult, len(discount.Conditions))
+	for i, condition := range discount.Conditions {
+		results[i] = e.EvaluateCondition(discount, condition, ec)
+	}
+	return results
+}
+
+// EvaluateCondition 評估單一條件，無法辨識的條件類型或條件值一律視為不通過
+func (e *ConditionEvaluator) EvaluateCondition(discount *models.Discount, condition models.DiscountCondition, ec EvaluationContext) ConditionResult {
+	result := ConditionResult{
+		ConditionID: condition.ID,
+		Type:        condition.Type,
+		Value:       condition.Value,
+	}
+
+	switch condition.Type {
+	case models.CartTotal:
+		minTotal, err := models.ParseDecimal(condition.Value)
+		if err != nil {
+			result.Reason = fmt.Sprintf("invalid cart total condition %q", condition.Value)
+			break
+		}
+		result.Passed = !ec.CartTotal.LessThan(minTotal)
+		if !result.Passed {
+			result.Reason = fmt.Sprintf("cart total must be at least %s", condition.Value)
+		}
+
+	case models.MembershipLevel:
+		result.Passed = membershipSatisfied(ec.Tier, condition)
+		if !result.Passed {
+			result.Reason = fmt.Sprintf("membership tier %s required", condition.Value)
+		}
+
+	case models.ProductCategory:
+		for _, line := range ec.Lines {
+			if categoryMatches(line.Category, condition.Value) {
+				result.Passed = true
+				break
+			}
+		}
+		if !result.Passed {
+			result.Reason = fmt.Sprintf("cart has no products in category %s", condition.Value)
+		}
+
+	case models.MinQuantity:
+		minQuantity, err := strconv.Atoi(strings.TrimSpace(condition.Value))
+		if err != nil {
+			result.Reason = fmt.Sprintf("invalid minimum quantity condition %q", condition.Value)
+			break
+		}
+		quantity := qualifyingQuantity(discount, ec.Lines)
+		result.Passed = quantity >= minQuantity
+		if !result.Passed {
+			result.Reason = fmt.Sprintf("at least %d qualifying items required, cart has %d", minQuantity, quantity)
+		}
+
+	default:
+		result.Reason = fmt.Sprintf("unsupported condition type %s", condition.Type)
+	}
+
+	return result
+}
+
+// qualifyingQuantity 計算符合折扣適用範圍與類別條件的商品總數
+func qualifyingQuantity(discount *models.Discount, lines []CartLine) int {
+	rules := newTargetRules(discount)
+
+	var categories []string
+	for _, condition := range discount.Conditions {
+		if condition.Type == models.ProductCategory {
+			categories = append(categories, condition.Value)
+		}
+	}
+
+	quantity := 0
+	for _, line := range lines {
+		if !rules.matchesLine(line) {
+			continue
+		}
+		if len(categories) > 0 && !anyCategoryMatches(line.Category, categories) {
+			continue
+		}
+		quantity += line.Quantity
+	}
+	return quantity
+}
+
+func anyCategoryMatches(category string, wanted []string) bool {
+	for _, w := range wanted {
+		if categoryMatches(category, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryMatches 比對商品類別，忽略大小寫與前後空白
+func categoryMatches(category, wanted string) bool {
+	category = strings.TrimSpace(category)
+	return category != "" && strings.EqualFold(category, strings.TrimSpace(wanted))
+}
+
+// failedConditions 回傳未通過的條件
+func failedConditions(results []ConditionResult) []ConditionResult {
+	failed := make([]ConditionResult, 0)
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
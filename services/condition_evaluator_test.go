@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionEvaluator(t *testing.T) {
+	evaluator := NewConditionEvaluator()
+
+	lines := []CartLine{
+		{ProductID: 1, UnitPrice: dec("100"), Quantity: 2, Category: "Shoes"},
+		{ProductID: 2, UnitPrice: dec("50"), Quantity: 1, Category: "Bags"},
+	}
+	ec := EvaluationContext{Tier: models.MembershipGold, CartTotal: dec("250"), Lines: lines}
+
+	tests := []struct {
+		name      string
+		products  []models.DiscountProduct
+		condition models.DiscountCondition
+		passed    bool
+		reason    string
+	}{
+		{
+			name:      "購物車總額達標",
+			condition: models.DiscountCondition{Type: models.CartTotal, Value: "200"},
+			passed:    true,
+		},
+		{
+			name:      "購物車總額未達標",
+			condition: models.DiscountCondition{Type: models.CartTotal, Value: "300"},
+			reason:    "cart total must be at least 300",
+		},
+		{
+			name:      "會員等級達標",
+			condition: models.DiscountCondition{Type: models.MembershipLevel, Value: "SILVER"},
+			passed:    true,
+		},
+		{
+			name:      "會員等級不足",
+			condition: models.DiscountCondition{Type: models.MembershipLevel, Value: "PLATINUM"},
+			reason:    "membership tier PLATINUM required",
+		},
+		{
+			name:      "購物車有指定類別",
+			condition: models.DiscountCondition{Type: models.ProductCategory, Value: "shoes"},
+			passed:    true,
+		},
+		{
+			name:      "購物車沒有指定類別",
+			condition: models.DiscountCondition{Type: models.ProductCategory, Value: "Hats"},
+			reason:    "cart has no products in category Hats",
+		},
+		{
+			name:      "整台購物車數量達標",
+			condition: models.DiscountCondition{Type: models.MinQuantity, Value: "3"},
+			passed:    true,
+		},
+		{
+			name:      "指定商品數量未達標",
+			products:  []models.DiscountProduct{{ProductID: 2}},
+			condition: models.DiscountCondition{Type: models.MinQuantity, Value: "2"},
+			reason:    "at least 2 qualifying items required, cart has 1",
+		},
+		{
+			name:      "條件值格式錯誤",
+			condition: models.DiscountCondition{Type: models.MinQuantity, Value: "two"},
+			reason:    `invalid minimum quantity condition "two"`,
+		},
+		{
+			name:      "未知的條件類型",
+			condition: models.DiscountCondition{Type: "BIRTHDAY", Value: "today"},
+			reason:    "unsupported condition type BIRTHDAY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount := &models.Discount{
+				Products:   tt.products,
+				Conditions: []models.DiscountCondition{tt.condition},
+			}
+
+			results := evaluator.Evaluate(discount, ec)
+			assert.Len(t, results, 1)
+			assert.Equal(t, tt.passed, results[0].Passed)
+			assert.Equal(t, tt.reason, results[0].Reason)
+		})
+	}
+}
+
+func TestMinQuantityCountsCategory(t *testing.T) {
+	evaluator := NewConditionEvaluator()
+
+	// 「鞋類買3件」：只計算鞋類的數量
+	discount := &models.Discount{
+		Conditions: []models.DiscountCondition{
+			{Type: models.ProductCategory, Value: "Shoes"},
+			{Type: models.MinQuantity, Value: "3"},
+		},
+	}
+	lines := []CartLine{
+		{ProductID: 1, UnitPrice: dec("100"), Quantity: 2, Category: "Shoes"},
+		{ProductID: 2, UnitPrice: dec("50"), Quantity: 5, Category: "Bags"},
+	}
+
+	results := evaluator.Evaluate(discount, EvaluationContext{Lines: lines})
+	assert.True(t, results[0].Passed)
+	assert.False(t, results[1].Passed)
+
+	lines[0].Quantity = 3
+	results = evaluator.Evaluate(discount, EvaluationContext{Lines: lines})
+	assert.True(t, results[1].Passed)
+}
+
+func TestMinQuantityExcludesSingleItemCart(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:      "Buy 3 Save 10%",
+		Type:      models.Percentage,
+		Value:     dec("10"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+	}
+	assert.NoError(t, service.CreateDiscount(ctx, discount))
+	db.Create(&models.DiscountCondition{DiscountID: discount.ID, Type: models.MinQuantity, Value: "3"})
+	db.Create(&models.DiscountProduct{DiscountID: discount.ID, ProductID: 1})
+
+	single := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 1}}
+	available, err := service.FindAvailableDiscounts(ctx, DiscountQuery{Lines: single})
+	assert.NoError(t, err)
+	assert.Empty(t, available)
+
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: single})
+	assert.NoError(t, err)
+	assert.Empty(t, application.Applied)
+	assert.Len(t, application.Rejected, 1)
+	assert.Equal(t, "at least 3 qualifying items required, cart has 1", application.Rejected[0].Reason)
+	assert.Len(t, application.Rejected[0].Conditions, 1)
+	assert.False(t, application.Rejected[0].Conditions[0].Passed)
+
+	three := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 3}}
+	available, err = service.FindAvailableDiscounts(ctx, DiscountQuery{Lines: three})
+	assert.NoError(t, err)
+	assert.Len(t, available, 1)
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCouponNotFound       = errors.New("coupon not found")
+	ErrCouponExpired        = errors.New("coupon has expired")
+	ErrCouponUsedUp         = errors.New("coupon has reached its redemption limit")
+	ErrCouponAlreadyApplied = errors.New("a coupon for this discount is already applied to the cart")
+	ErrInvalidCouponCode    = errors.New("coupon code cannot be empty")
+	ErrInvalidCouponCount   = errors.New("coupon count must be between 1 and 10000")
+	ErrInvalidCouponLength  = errors.New("invalid coupon code length")
+	ErrInvalidRedemptions   = errors.New("max redemptions cannot be negative")
+	ErrCouponAlreadyExists  = errors.New("coupon code already exists")
+)
+
+const (
+	// 產生優惠碼使用的字元，排除容易混淆的 0/O、1/I/L
+	couponAlphabet      = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+	defaultCouponLength = 10
+	maxCouponBatch      = 10000
+	// 產生的代碼與既有代碼重複時最多重試的次數
+	maxCouponGenerateAttempts = 5
+	// 優惠碼欄位的長度上限，對應 Coupon.Code 的 size:64
+	maxCouponCodeLength = 64
+	// 批次產生的優惠碼未指定使用次數時為單次使用
+	defaultGeneratedRedemptions = 1
+	// 可產生的代碼數量至少要是需求的幾倍，避免隨機抽取時大量重複
+	couponCodeSpaceFactor = 100
+	// 每一輪每個需要的代碼最多抽取的次數
+	couponDrawsPerCode = 20
+)
+
+// 批次產生優惠碼的輸入
+type GenerateCouponsInput struct {
+	DiscountID     int64
+	Count          int
+	Prefix         string
+	Length         int  // 隨機部分的長度，為 0 時使用預設長度
+	MaxRedemptions *int // 為空時為單次使用，明確指定 0 才不限次數
+	ExpiresAt      *time.Time
+}
+
+type CouponService struct {
+	db *gorm.DB
+}
+
+func NewCouponService(db *gorm.DB) *CouponService {
+	return &CouponService{db: db}
+}
+
+// CreateCoupon 為折扣建立指定代碼的優惠碼
+func (s *CouponService) CreateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	coupon.Code = normalizeCouponCode(coupon.Code)
+	if coupon.Code == "" {
+		return ErrInvalidCouponCode
+	}
+	if len(coupon.Code) > maxCouponCodeLength {
+		return fmt.Errorf("%w: code cannot exceed %d characters", ErrInvalidCouponLength, maxCouponCodeLength)
+	}
+	if coupon.MaxRedemptions < 0 {
+		return ErrInvalidRedemptions
+	}
+	if err := s.db.WithContext(ctx).First(&models.Discount{}, coupon.DiscountID).Error; err != nil {
+		return err
+	}
+	var existing int64
+	if err := s.db.WithContext(ctx).Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return fmt.Errorf("%w: %s", ErrCouponAlreadyExists, coupon.Code)
+	}
+
+	coupon.CreatedAt = time.Now()
+	coupon.UpdatedAt = time.Now()
+	return s.db.WithContext(ctx).Create(coupon).Error
+}
+
+// GenerateCoupons 為折扣批次產生不重複的隨機優惠碼
+func (s *CouponService) GenerateCoupons(ctx context.Context, input GenerateCouponsInput) ([]models.Coupon, error) {
+	if input.Count <= 0 || input.Count > maxCouponBatch {
+		return nil, ErrInvalidCouponCount
+	}
+	maxRedemptions := defaultGeneratedRedemptions
+	if input.MaxRedemptions != nil {
+		maxRedemptions = *input.MaxRedemptions
+	}
+	if maxRedemptions < 0 {
+		return nil, ErrInvalidRedemptions
+	}
+	if input.Length < 0 {
+		return nil, fmt.Errorf("%w: length cannot be negative", ErrInvalidCouponLength)
+	}
+	length := input.Length
+	if length == 0 {
+		length = defaultCouponLength
+	}
+	prefix := normalizeCouponCode(input.Prefix)
+	if len(prefix)+length > maxCouponCodeLength {
+		return nil, fmt.Errorf("%w: prefix and code cannot exceed %d characters", ErrInvalidCouponLength, maxCouponCodeLength)
+	}
+	if !couponCodeSpaceAtLeast(length, input.Count*couponCodeSpaceFactor) {
+		return nil, fmt.Errorf("%w: length %d is too short for %d unique codes", ErrInvalidCouponLength, length, input.Count)
+	}
+
+	var coupons []models.Coupon
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.Discount{}, input.DiscountID).Error; err != nil {
+			return err
+		}
+
+		codes := make(map[string]bool, input.Count)
+		generated := make([]string, 0, input.Count)
+		for attempt := 0; len(generated) < input.Count; attempt++ {
+			if attempt == maxCouponGenerateAttempts {
+				return errors.New("unable to generate enough unique coupon codes")
+			}
+
+			needed := input.Count - len(generated)
+			batch := make([]string, 0, needed)
+			pending := make(map[string]bool, needed)
+			for draws := 0; len(batch) < needed && draws < needed*couponDrawsPerCode; draws++ {
+				code, err := randomCouponCode(prefix, length)
+				if err != nil {
+					return err
+				}
+				if !codes[code] && !pending[code] {
+					pending[code] = true
+					batch = append(batch, code)
+				}
+			}
+
+			// 排除資料庫中已存在的代碼
+			var existing []string
+			if err := tx.Model(&models.Coupon{}).Where("code IN ?", batch).Pluck("code", &existing).Error; err != nil {
+				return err
+			}
+			taken := make(map[string]bool, len(existing))
+			for _, code := range existing {
+				taken[code] = true
+			}
+			for _, code := range batch {
+				if !taken[code] {
+					codes[code] = true
+					generated = append(generated, code)
+				}
+			}
+		}
+
+		now := time.Now()
+		coupons = make([]models.Coupon, 0, len(generated))
+		for _, code := range generated {
+			coupons = append(coupons, models.Coupon{
+				DiscountID:     input.DiscountID,
+				Code:           code,
+				MaxRedemptions: maxRedemptions,
+				ExpiresAt:      input.ExpiresAt,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			})
+		}
+		return tx.CreateInBatches(&coupons, 500).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return coupons, nil
+}
+
+// ValidateCoupon 依代碼取得優惠碼，並確認未過期且仍有使用次數
+func (s *CouponService) ValidateCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	coupon := &models.Coupon{}
+	err := s.db.WithContext(ctx).Where("code = ?", normalizeCouponCode(code)).First(coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCoupon(coupon, time.Now()); err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// ApplyCoupon 將優惠碼加入購物車，同一個折扣只能使用一組優惠碼
+func (s *CouponService) ApplyCoupon(ctx context.Context, cartID int64, code string) (*models.CartCoupon, error) {
+	coupon, err := s.ValidateCoupon(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	cartCoupon := &models.CartCoupon{
+		CartID:     cartID,
+		DiscountID: coupon.DiscountID,
+		CouponID:   coupon.ID,
+		Code:       coupon.Code,
+		CreatedAt:  time.Now(),
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := NewCartService(tx).ensureOpen(tx, cartID); err != nil {
+			return err
+		}
+
+		var existing models.CartCoupon
+		err := tx.Where("cart_id = ? AND discount_id = ?", cartID, coupon.DiscountID).First(&existing).Error
+		if err == nil {
+			if existing.CouponID == coupon.ID {
+				*cartCoupon = existing
+				return nil
+			}
+			return ErrCouponAlreadyApplied
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		return tx.Create(cartCoupon).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cartCoupon, nil
+}
+
+// RemoveCoupon 從購物車移除優惠碼
+func (s *CouponService) RemoveCoupon(ctx context.Context, cartID int64, code string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := NewCartService(tx).ensureOpen(tx, cartID); err != nil {
+			return err
+		}
+
+		result := tx.Where("cart_id = ? AND code = ?", cartID, normalizeCouponCode(code)).Delete(&models.CartCoupon{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCouponNotFound
+		}
+		return nil
+	})
+}
+
+// CartCoupons 取得購物車中仍可使用的優惠碼，已過期或用完的優惠碼會被略過
+func (s *CouponService) CartCoupons(ctx context.Context, cart *models.Cart) ([]models.Coupon, error) {
+	if len(cart.Coupons) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(cart.Coupons))
+	for i, cc := range cart.Coupons {
+		ids[i] = cc.CouponID
+	}
+
+	var coupons []models.Coupon
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&coupons).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	valid := make([]models.Coupon, 0, len(coupons))
+	for _, coupon := range coupons {
+		if checkCoupon(&coupon, now) == nil {
+			valid = append(valid, coupon)
+		}
+	}
+	return valid, nil
+}
+
+// RedeemCoupons 以條件更新增加優惠碼的使用次數，任一優惠碼已用完時回傳 ErrCouponUsedUp
+func (s *CouponService) RedeemCoupons(ctx context.Context, couponIDs []int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, id := range couponIDs {
+			result := tx.Model(&models.Coupon{}).
+				Where("id = ? AND (max_redemptions = 0 OR redemption_count < max_redemptions)", id).
+				UpdateColumn("redemption_count", gorm.Expr("redemption_count + 1"))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrCouponUsedUp
+			}
+		}
+		return nil
+	})
+}
+
+// ReleaseCoupons 歸還優惠碼的使用次數，用於訂單取消或退款
+func (s *CouponService) ReleaseCoupons(ctx context.Context, couponIDs []int64) error {
+	for _, id := range couponIDs {
+		err := s.db.WithContext(ctx).Model(&models.Coupon{}).
+			Where("id = ? AND redemption_count > 0", id).
+			UpdateColumn("redemption_count", gorm.Expr("redemption_count - 1")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCoupon(coupon *models.Coupon, now time.Time) error {
+	if coupon.Expired(now) {
+		return ErrCouponExpired
+	}
+	if coupon.UsedUp() {
+		return ErrCouponUsedUp
+	}
+	return nil
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// couponCodeSpaceAtLeast 判斷長度為 length 的隨機部分是否至少能產生 n 種代碼
+func couponCodeSpaceAtLeast(length, n int) bool {
+	space := 1
+	for i := 0; i < length && space < n; i++ {
+		space *= len(couponAlphabet)
+	}
+	return space >= n
+}
+
+func randomCouponCode(prefix string, length int) (string, error) {
+	var b strings.Builder
+	b.Grow(len(prefix) + length)
+	b.WriteString(prefix)
+
+	base := big.NewInt(int64(len(couponAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(couponAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
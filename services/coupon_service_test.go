@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCouponValidation(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	couponService := NewCouponService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:           "Coupon 10% Off",
+		Type:           models.Percentage,
+		Value:          dec("10"),
+		StartDate:      now.Add(-1 * time.Hour),
+		EndDate:        now.Add(24 * time.Hour),
+		RequiresCoupon: true,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	expiresAt := now.Add(-1 * time.Minute)
+	for _, coupon := range []*models.Coupon{
+		{DiscountID: discount.ID, Code: " welcome10 ", MaxRedemptions: 1},
+		{DiscountID: discount.ID, Code: "EXPIRED", ExpiresAt: &expiresAt},
+		{DiscountID: discount.ID, Code: "USEDUP", MaxRedemptions: 2, RedemptionCount: 2},
+		{DiscountID: discount.ID, Code: "FOREVER"},
+	} {
+		assert.NoError(t, couponService.CreateCoupon(ctx, coupon))
+	}
+
+	tests := []struct {
+		code string
+		err  error
+	}{
+		{code: "WELCOME10"},
+		{code: "welcome10"},
+		{code: "FOREVER"},
+		{code: "EXPIRED", err: ErrCouponExpired},
+		{code: "USEDUP", err: ErrCouponUsedUp},
+		{code: "UNKNOWN", err: ErrCouponNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			coupon, err := couponService.ValidateCoupon(ctx, tt.code)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, discount.ID, coupon.DiscountID)
+		})
+	}
+
+	// 代碼不可重複
+	assert.ErrorIs(t, couponService.CreateCoupon(ctx, &models.Coupon{DiscountID: discount.ID, Code: "welcome10"}), ErrCouponAlreadyExists)
+	// 折扣不存在
+	assert.Error(t, couponService.CreateCoupon(ctx, &models.Coupon{DiscountID: 999, Code: "NOPE"}))
+}
+
+func TestGenerateCoupons(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	couponService := NewCouponService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{Name: "Bulk", Type: models.Fixed, Value: dec("5"), StartDate: now, EndDate: now.Add(time.Hour), RequiresCoupon: true}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	// 未指定使用次數時為單次使用
+	coupons, err := couponService.GenerateCoupons(ctx, GenerateCouponsInput{DiscountID: discount.ID, Count: 200, Prefix: "spring-", Length: 8})
+	assert.NoError(t, err)
+	assert.Len(t, coupons, 200)
+
+	seen := make(map[string]bool, len(coupons))
+	for _, coupon := range coupons {
+		assert.True(t, strings.HasPrefix(coupon.Code, "SPRING-"))
+		assert.Len(t, coupon.Code, len("SPRING-")+8)
+		assert.Equal(t, 1, coupon.MaxRedemptions)
+		assert.False(t, seen[coupon.Code])
+		seen[coupon.Code] = true
+	}
+
+	var count int64
+	db.Model(&models.Coupon{}).Where("discount_id = ?", discount.ID).Count(&count)
+	assert.Equal(t, int64(200), count)
+
+	_, err = couponService.GenerateCoupons(ctx, GenerateCouponsInput{DiscountID: discount.ID, Count: 0})
+	assert.ErrorIs(t, err, ErrInvalidCouponCount)
+
+	// 明確指定 0 才不限次數
+	unlimited := 0
+	coupons, err = couponService.GenerateCoupons(ctx, GenerateCouponsInput{DiscountID: discount.ID, Count: 1, MaxRedemptions: &unlimited})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, coupons[0].MaxRedemptions)
+
+	negative := -1
+	tests := []struct {
+		name  string
+		input GenerateCouponsInput
+		err   error
+	}{
+		{name: "長度不足以產生足夠的代碼", input: GenerateCouponsInput{Count: 40, Length: 1}, err: ErrInvalidCouponLength},
+		{name: "長度為負數", input: GenerateCouponsInput{Count: 1, Length: -1}, err: ErrInvalidCouponLength},
+		{name: "超過欄位長度", input: GenerateCouponsInput{Count: 1, Prefix: strings.Repeat("A", 60), Length: 5}, err: ErrInvalidCouponLength},
+		{name: "使用次數為負數", input: GenerateCouponsInput{Count: 1, MaxRedemptions: &negative}, err: ErrInvalidRedemptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.DiscountID = discount.ID
+			_, err := couponService.GenerateCoupons(ctx, tt.input)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	// 短代碼在有足夠空間時仍可產生
+	coupons, err = couponService.GenerateCoupons(ctx, GenerateCouponsInput{DiscountID: discount.ID, Count: 5, Prefix: "S", Length: 2})
+	assert.NoError(t, err)
+	assert.Len(t, coupons, 5)
+}
+
+func TestCheckoutRedeemsCoupon(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	couponService := NewCouponService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:           "Coupon 20 Off",
+		Type:           models.Fixed,
+		Value:          dec("20"),
+		StartDate:      now.Add(-1 * time.Hour),
+		EndDate:        now.Add(24 * time.Hour),
+		RequiresCoupon: true,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+	coupon := &models.Coupon{DiscountID: discount.ID, Code: "ONCE", MaxRedemptions: 1}
+	assert.NoError(t, couponService.CreateCoupon(ctx, coupon))
+
+	first, _ := cartService.CreateCart(ctx, 1)
+	second, _ := cartService.CreateCart(ctx, 2)
+	for _, cart := range []*models.Cart{first, second} {
+		_, err := cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+		assert.NoError(t, err)
+	}
+
+	// 未輸入優惠碼時不會套用
+	cart, _ := cartService.GetCart(ctx, first.ID)
+	coupons, err := couponService.CartCoupons(ctx, cart)
+	assert.NoError(t, err)
+	application, err := discountService.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: CartLines(cart), Coupons: coupons})
+	assert.NoError(t, err)
+	assert.Empty(t, application.Applied)
+	assert.Equal(t, "coupon code required", application.Rejected[0].Reason)
+
+	// 兩台購物車都輸入同一組單次優惠碼
+	for _, cart := range []*models.Cart{first, second} {
+		_, err := couponService.ApplyCoupon(ctx, cart.ID, "once")
+		assert.NoError(t, err)
+	}
+	_, err = couponService.ApplyCoupon(ctx, first.ID, "ONCE")
+	assert.NoError(t, err)
+
+	cart, _ = cartService.GetCart(ctx, first.ID)
+	assert.Len(t, cart.Coupons, 1)
+	coupons, err = couponService.CartCoupons(ctx, cart)
+	assert.NoError(t, err)
+	application, err = discountService.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: CartLines(cart), Coupons: coupons})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, dec("80"), application.Total)
+
+	order, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: first.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("80"), order.Total)
+	assert.Equal(t, "ONCE", order.Discounts[0].CouponCode)
+
+	var redeemed models.Coupon
+	db.First(&redeemed, coupon.ID)
+	assert.Equal(t, 1, redeemed.RedemptionCount)
+
+	// 優惠碼已用完，第二台購物車預期的折扣不再套用
+	_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: second.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.ErrorIs(t, err, ErrAppliedDiscountsChanged)
+
+	_, err = couponService.ApplyCoupon(ctx, second.ID, "ONCE")
+	assert.ErrorIs(t, err, ErrCouponUsedUp)
+
+	// 移除優惠碼
+	assert.NoError(t, couponService.RemoveCoupon(ctx, second.ID, "once"))
+	assert.ErrorIs(t, couponService.RemoveCoupon(ctx, second.ID, "ONCE"), ErrCouponNotFound)
+}
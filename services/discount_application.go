@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"shopping_cart/models"
+)
+
+const (
+	// 使用次數已達上限的拒絕原因，結帳時用來判斷折扣是否在購物期間用完
+	reasonUsageLimitReached = "usage limit reached"
+	// 折扣符合資格但沒有折抵任何金額
+	reasonNoReduction = "discount does not reduce the cart total"
+	// 需要優惠碼但購物車未輸入
+	reasonCouponRequired = "coupon code required"
+	// 購物車沒有折扣適用的商品
+	reasonNoEligibleProducts = "no eligible products in cart"
+	// 折扣沒有購物車貨幣的金額，也無法換算
+	reasonCurrencyUnavailableFormat = "discount has no value in currency %s"
+)
+
+// 套用折扣到購物車的輸入
+type ApplyDiscountInput struct {
+	CartID      int64
+	UserID      int64
+	CartTotal   models.Decimal // 用於 CART_TOTAL 條件，為 0 時以明細小計計算
+	ProductIDs  []int64        // 限定參與折扣的商品，空白表示整台購物車
+	Lines       []CartLine
+	Strategy    StackingStrategy // 空白時依優先級選擇
+	Coupons     []models.Coupon  // 購物車中仍可使用的優惠碼
+	Currency    models.Currency  // 購物車的貨幣，空白時使用預設貨幣
+	ShippingFee models.Decimal   // 運費，只有運費折扣會折抵
+}
+
+// 未被套用的折扣及原因
+type RejectedDiscount struct {
+	DiscountID   int64             `json:"discount_id"`
+	DiscountName string            `json:"discount_name"`
+	Reason       string            `json:"reason"`
+	Conditions   []ConditionResult `json:"conditions,omitempty"` // 各條件的評估結果
+}
+
+// 套用折扣後的結果
+type DiscountApplication struct {
+	CartID           int64              `json:"cart_id"`
+	Currency         models.Currency    `json:"currency"`
+	Subtotal         models.Decimal     `json:"subtotal"`
+	ShippingFee      models.Decimal     `json:"shipping_fee"`
+	ShippingDiscount models.Decimal     `json:"shipping_discount"` // 運費折扣，已包含在 DiscountTotal
+	DiscountTotal    models.Decimal     `json:"discount_total"`
+	Total            models.Decimal     `json:"total"`
+	Applied          []RuleDiscount     `json:"applied"`
+	Rejected         []RejectedDiscount `json:"rejected"`
+	Lines            []LineBreakdown    `json:"lines"`
+	Decisions        []StackingDecision `json:"decisions"` // 疊加決策過程
+}
+
+// ApplyDiscounts 評估目前有效的折扣，並依疊加規則決定套用的組合
+func (s *DiscountService) ApplyDiscounts(ctx context.Context, input ApplyDiscountInput) (*DiscountApplication, error) {
+	if s.rejectClientTotals && !input.CartTotal.IsZero() {
+		return nil, ErrClientTotalRejected
+	}
+	discounts, err := s.activeDiscounts(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	tier, err := s.membership.GetMembershipTier(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	redemptions, err := s.userRedemptionCounts(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	held, err := s.heldReservedDiscountIDs(ctx, input.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := filterLines(input.Lines, input.ProductIDs)
+	cartTotal := input.CartTotal
+	if !cartTotal.IsPositive() {
+		cartTotal = linesTotal(lines)
+	}
+
+	application := &DiscountApplication{
+		CartID:   input.CartID,
+		Currency: input.Currency.OrDefault(),
+		Applied:  []RuleDiscount{},
+		Rejected: []RejectedDiscount{},
+	}
+
+	ec := EvaluationContext{
+		Tier:              tier,
+		CartTotal:         cartTotal,
+		Lines:             lines,
+		CouponDiscountIDs: couponDiscountIDs(input.Coupons),
+		UserID:            input.UserID,
+		Redemptions:       redemptions,
+		HeldDiscountIDs:   held,
+	}
+	eligible := make([]models.Discount, 0, len(discounts))
+	for _, discount := range discounts {
+		// 以購物車的貨幣表示折扣金額與門檻
+		discount, err := localizeDiscount(discount, application.Currency, s.rates, s.rounding)
+		if err != nil {
+			application.Rejected = append(application.Rejected, rejected(&discount, fmt.Sprintf(reasonCurrencyUnavailableFormat, application.Currency)))
+			continue
+		}
+		if reason, results := rejectionReason(&discount, ec); reason != "" {
+			r := rejected(&discount, reason)
+			r.Conditions = results
+			application.Rejected = append(application.Rejected, r)
+			continue
+		}
+		eligible = append(eligible, discount)
+	}
+
+	// 依可疊加性與策略決定最終套用的折扣
+	engine := s.pricingEngine()
+	resolver := NewStackingResolver().WithEngine(engine).WithShippingFee(input.ShippingFee)
+	var resolution *StackingResolution
+	if input.Strategy == StrategyMaxSavings {
+		resolution = resolver.MaximizeSavings(eligible, lines)
+	} else {
+		resolution = resolver.Resolve(eligible)
+	}
+	best := engine.CalculateWithShipping(lines, input.ShippingFee, resolution.Applied)
+
+	appliedIDs := make(map[int64]bool, len(best.Rules))
+	for _, rule := range best.Rules {
+		appliedIDs[rule.DiscountID] = true
+	}
+	discountsByID := make(map[int64]*models.Discount, len(eligible))
+	for i := range eligible {
+		discountsByID[eligible[i].ID] = &eligible[i]
+	}
+	for i := range resolution.Decisions {
+		decision := &resolution.Decisions[i]
+		if decision.Applied && !appliedIDs[decision.DiscountID] {
+			decision.Applied = false
+			decision.Reason = reasonNoReduction
+		}
+		if !decision.Applied {
+			application.Rejected = append(application.Rejected, rejected(discountsByID[decision.DiscountID], decision.Reason))
+		}
+	}
+	application.Decisions = resolution.Decisions
+
+	application.Subtotal = best.Subtotal
+	application.ShippingFee = best.Shipping.Fee
+	application.ShippingDiscount = best.Shipping.DiscountTotal
+	application.DiscountTotal = best.TotalDiscount
+	application.Total = best.Total
+	application.Applied = append(application.Applied, best.Rules...)
+	application.Lines = best.Lines
+
+	return application, nil
+}
+
+// rejectionReason 檢查折扣是否適用於購物車，適用時回傳空字串
+// 折扣的所有條件都必須通過，沒有任何條件的折扣視為無條件適用
+func rejectionReason(discount *models.Discount, ec EvaluationContext) (string, []ConditionResult) {
+	if discount.MaxUsage > 0 {
+		// 其他購物車保留中的名額也計入，購物車自己保留的名額不算
+		taken := discount.UsageCount + discount.ReservedCount
+		if ec.HeldDiscountIDs[discount.ID] {
+			taken--
+		}
+		if taken >= discount.MaxUsage {
+			return reasonUsageLimitReached, nil
+		}
+	}
+	if discount.MaxUsagePerUser > 0 {
+		if ec.UserID == 0 {
+			return reasonSignInRequired, nil
+		}
+		if ec.Redemptions[discount.ID] >= discount.MaxUsagePerUser {
+			return reasonUserLimitReached, nil
+		}
+	}
+	if discount.RequiresCoupon && !ec.CouponDiscountIDs[discount.ID] {
+		return reasonCouponRequired, nil
+	}
+	if discount.Type == models.Gift {
+		// 只有贈品的購物車不送贈品
+		if len(ec.Lines) == 0 {
+			return reasonNoEligibleProducts, nil
+		}
+		if !giftInStock(discount) {
+			return reasonGiftOutOfStock, nil
+		}
+	}
+
+	results := NewConditionEvaluator().Evaluate(discount, ec)
+	if failed := failedConditions(results); len(failed) > 0 {
+		return failed[0].Reason, results
+	}
+
+	if discount.Type == models.Bundle {
+		units := make(map[int64]int, len(ec.Lines))
+		for _, line := range ec.Lines {
+			units[line.ProductID] += line.Quantity
+		}
+		if bundleCount(discount.BundleItems, units) == 0 {
+			return reasonBundleIncomplete, results
+		}
+	}
+
+	if rules := newTargetRules(discount); rules.restricted() {
+		matched := false
+		for _, line := range ec.Lines {
+			if rules.matchesLine(line) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return reasonNoEligibleProducts, results
+		}
+	}
+
+	return "", results
+}
+
+// linesTotal 計算明細的小計
+func linesTotal(lines []CartLine) models.Decimal {
+	var total models.Decimal
+	for _, line := range lines {
+		total = total.Add(line.UnitPrice.Mul(int64(line.Quantity)))
+	}
+	return total
+}
+
+// filterLines 只保留指定的商品，未指定時回傳全部明細
+func filterLines(lines []CartLine, productIDs []int64) []CartLine {
+	if len(productIDs) == 0 {
+		return lines
+	}
+
+	wanted := make(map[int64]bool, len(productIDs))
+	for _, id := range productIDs {
+		wanted[id] = true
+	}
+
+	filtered := make([]CartLine, 0, len(lines))
+	for _, line := range lines {
+		if wanted[line.ProductID] {
+			filtered = append(filtered, line)
+		}
+	}
+	return filtered
+}
+
+func couponDiscountIDs(coupons []models.Coupon) map[int64]bool {
+	ids := make(map[int64]bool, len(coupons))
+	for _, coupon := range coupons {
+		ids[coupon.DiscountID] = true
+	}
+	return ids
+}
+
+func rejected(discount *models.Discount, reason string) RejectedDiscount {
+	return RejectedDiscount{
+		DiscountID:   discount.ID,
+		DiscountName: discount.Name,
+		Reason:       reason,
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDiscounts(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newDiscount := func(name string, discountType models.DiscountType, value models.Decimal, stackable bool) *models.Discount {
+		discount := &models.Discount{
+			Name:      name,
+			Type:      discountType,
+			Value:     value,
+			StartDate: now.Add(-1 * time.Hour),
+			EndDate:   now.Add(24 * time.Hour),
+			Priority:  models.PriorityMedium,
+			Stackable: stackable,
+		}
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+		return discount
+	}
+
+	percentage := newDiscount("20% Off", models.Percentage, dec("20"), false)
+	fixed := newDiscount("50 Off", models.Fixed, dec("50"), false)
+	stackable := newDiscount("10 Off", models.Fixed, dec("10"), true)
+	threshold := newDiscount("Spend 5000", models.Threshold, dec("500"), true)
+	productOnly := newDiscount("Product 99 BOGO", models.BOGO, dec("1"), true)
+	usedUp := newDiscount("Used Up", models.Percentage, dec("50"), true)
+
+	db.Create(&models.DiscountCondition{DiscountID: threshold.ID, Type: models.CartTotal, Value: "5000"})
+	db.Create(&models.DiscountProduct{DiscountID: productOnly.ID, ProductID: 99})
+	db.Model(usedUp).Updates(map[string]interface{}{"max_usage": 1, "usage_count": 1})
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("500"), Quantity: 2}}
+
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{CartID: 1, Lines: lines})
+	assert.NoError(t, err)
+
+	// 1000 的購物車：同優先級時先建立的 20% 優先於固定 50，再疊加固定 10
+	assert.Equal(t, int64(1), application.CartID)
+	assert.Equal(t, dec("1000"), application.Subtotal)
+	assert.Equal(t, dec("210"), application.DiscountTotal)
+	assert.Equal(t, dec("790"), application.Total)
+
+	appliedIDs := make([]int64, 0, len(application.Applied))
+	for _, rule := range application.Applied {
+		appliedIDs = append(appliedIDs, rule.DiscountID)
+	}
+	assert.Equal(t, []int64{percentage.ID, stackable.ID}, appliedIDs)
+
+	reasons := make(map[int64]string, len(application.Rejected))
+	for _, r := range application.Rejected {
+		reasons[r.DiscountID] = r.Reason
+	}
+	assert.Len(t, reasons, 4)
+	assert.Contains(t, reasons[fixed.ID], "not stackable")
+	assert.Equal(t, "cart total must be at least 5000", reasons[threshold.ID])
+	assert.Equal(t, "no eligible products in cart", reasons[productOnly.ID])
+	assert.Equal(t, "usage limit reached", reasons[usedUp.ID])
+}
+
+func TestApplyDiscountsPrefersFixedOnSmallCart(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, discount := range []*models.Discount{
+		{Name: "20% Off", Type: models.Percentage, Value: dec("20")},
+		{Name: "50 Off", Type: models.Fixed, Value: dec("50")},
+	} {
+		discount.StartDate = now.Add(-1 * time.Hour)
+		discount.EndDate = now.Add(24 * time.Hour)
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+	}
+
+	// 購物車與結帳預設選擇折抵最多的組合
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 2}}
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines, Strategy: StrategyMaxSavings})
+	assert.NoError(t, err)
+
+	// 200 的購物車：固定 50 優於 20% (40)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, "50 Off", application.Applied[0].DiscountName)
+	assert.Equal(t, dec("150"), application.Total)
+	assert.Len(t, application.Rejected, 1)
+	assert.Equal(t, "20% Off", application.Rejected[0].DiscountName)
+}
+
+func TestApplyDiscountsHonorsPriority(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, discount := range []*models.Discount{
+		{Name: "50 Off", Type: models.Fixed, Value: dec("50"), Priority: models.PriorityLow},
+		{Name: "20% Off", Type: models.Percentage, Value: dec("20"), Priority: models.PriorityHigh},
+		{Name: "5% Member", Type: models.Percentage, Value: dec("5"), Priority: models.PriorityMedium, Stackable: true},
+	} {
+		discount.StartDate = now.Add(-1 * time.Hour)
+		discount.EndDate = now.Add(24 * time.Hour)
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+	}
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 2}}
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+
+	// 優先級較高的 20% 勝出 (即使固定 50 折抵較多)，再疊加 5%: 200 -> 160 -> 152
+	assert.Len(t, application.Applied, 2)
+	assert.Equal(t, "20% Off", application.Applied[0].DiscountName)
+	assert.Equal(t, "5% Member", application.Applied[1].DiscountName)
+	assert.Equal(t, dec("152"), application.Total)
+	assert.Len(t, application.Rejected, 1)
+	assert.Equal(t, "50 Off", application.Rejected[0].DiscountName)
+	assert.Equal(t, `not stackable with higher priority discount "20% Off"`, application.Rejected[0].Reason)
+
+	// 決策過程依優先級排列
+	assert.Len(t, application.Decisions, 3)
+	assert.Equal(t, "20% Off", application.Decisions[0].DiscountName)
+	assert.True(t, application.Decisions[0].Applied)
+	assert.Equal(t, "5% Member", application.Decisions[1].DiscountName)
+	assert.True(t, application.Decisions[1].Applied)
+	assert.Equal(t, "50 Off", application.Decisions[2].DiscountName)
+	assert.False(t, application.Decisions[2].Applied)
+}
+
+func TestApplyDiscountsMaxSavings(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, discount := range []*models.Discount{
+		{Name: "20% Off", Type: models.Percentage, Value: dec("20"), Priority: models.PriorityHigh},
+		{Name: "50 Off", Type: models.Fixed, Value: dec("50"), Priority: models.PriorityLow},
+		{Name: "10 Off", Type: models.Fixed, Value: dec("10"), Priority: models.PriorityMedium, Stackable: true},
+	} {
+		discount.StartDate = now.Add(-1 * time.Hour)
+		discount.EndDate = now.Add(24 * time.Hour)
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+	}
+
+	tests := []struct {
+		name      string
+		unitPrice models.Decimal
+		applied   []string
+		total     models.Decimal
+	}{
+		// 200 的購物車：固定 50 折抵較多，即使優先級較低 (200 -> 150 -> 140)
+		{name: "小額購物車選固定折扣", unitPrice: dec("100"), applied: []string{"50 Off", "10 Off"}, total: dec("140")},
+		// 1000 的購物車：20% 折抵較多 (1000 -> 800 -> 790)
+		{name: "大額購物車選百分比折扣", unitPrice: dec("500"), applied: []string{"20% Off", "10 Off"}, total: dec("790")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := []CartLine{{ProductID: 1, UnitPrice: tt.unitPrice, Quantity: 2}}
+			application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines, Strategy: StrategyMaxSavings})
+			assert.NoError(t, err)
+
+			names := make([]string, 0, len(application.Applied))
+			for _, rule := range application.Applied {
+				names = append(names, rule.DiscountName)
+			}
+			assert.Equal(t, tt.applied, names)
+			assert.Equal(t, tt.total, application.Total)
+			assert.Len(t, application.Rejected, 1)
+			assert.Contains(t, application.Rejected[0].Reason, "which saves more")
+		})
+	}
+}
+
+func TestApplyDiscountsMaxSavingsCap(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, discount := range []*models.Discount{
+		{Name: "30% Off up to 100", Type: models.Percentage, Value: dec("30"), MaxSavings: dec("100"), Priority: models.PriorityHigh},
+		{Name: "150 Off", Type: models.Fixed, Value: dec("150"), Priority: models.PriorityLow},
+	} {
+		discount.StartDate = now.Add(-1 * time.Hour)
+		discount.EndDate = now.Add(24 * time.Hour)
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+	}
+	assert.Error(t, service.CreateDiscount(ctx, &models.Discount{Name: "Invalid", MaxSavings: dec("-1")}))
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("500"), Quantity: 2}}
+
+	// 依優先級套用 30%，但最多折抵 100
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, dec("100"), application.Applied[0].Amount)
+	assert.Equal(t, []SavingsCap{CapMaxSavings}, application.Applied[0].Caps)
+
+	// 最大折抵策略以限制後的金額比較，改選固定 150
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines, Strategy: StrategyMaxSavings})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, "150 Off", application.Applied[0].DiscountName)
+	assert.Equal(t, dec("850"), application.Total)
+
+	// 購物車最低應付金額
+	application, err = service.WithPriceFloors(dec("0"), dec("950")).ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("950"), application.Total)
+	assert.Equal(t, []SavingsCap{CapMaxSavings, CapCartFloor}, application.Applied[0].Caps)
+}
+
+func TestApplyDiscountsWithShipping(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	itemDiscount := &models.Discount{Name: "20% Off", Type: models.Percentage, Value: dec("20"), Priority: models.PriorityHigh}
+	freeShipping := &models.Discount{Name: "Free Shipping Over 1000", Type: models.FreeShipping, Priority: models.PriorityLow}
+	halfShipping := &models.Discount{Name: "Half Shipping", Type: models.ShippingPercent, Value: dec("50"), Priority: models.PriorityMedium}
+	for _, discount := range []*models.Discount{itemDiscount, freeShipping, halfShipping} {
+		discount.StartDate = now.Add(-1 * time.Hour)
+		discount.EndDate = now.Add(24 * time.Hour)
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+	}
+	db.Create(&models.DiscountCondition{DiscountID: freeShipping.ID, Type: models.CartTotal, Value: "1000"})
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("600"), Quantity: 2}}
+
+	// 不可疊加只限制同一類：商品折扣與運費折扣各套用一個
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines, ShippingFee: dec("100")})
+	assert.NoError(t, err)
+	names := make([]string, 0, len(application.Applied))
+	for _, rule := range application.Applied {
+		names = append(names, rule.DiscountName)
+	}
+	assert.Equal(t, []string{"20% Off", "Half Shipping"}, names)
+	assert.Equal(t, dec("100"), application.ShippingFee)
+	assert.Equal(t, dec("50"), application.ShippingDiscount)
+	assert.Equal(t, dec("290"), application.DiscountTotal)
+	assert.Equal(t, dec("1010"), application.Total)
+
+	// 最大折抵策略選擇免運費
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines, ShippingFee: dec("100"), Strategy: StrategyMaxSavings})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("100"), application.ShippingDiscount)
+	assert.Equal(t, dec("960"), application.Total)
+
+	// 未達免運門檻
+	lines[0].Quantity = 1
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines, ShippingFee: dec("100"), Strategy: StrategyMaxSavings})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("50"), application.ShippingDiscount)
+	assert.Equal(t, dec("530"), application.Total)
+}
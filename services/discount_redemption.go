@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrDiscountUserLimitExceeded = errors.New("discount per-customer usage limit reached")
+
+const (
+	// 用戶已達該折扣的個人使用上限
+	reasonUserLimitReached = "per-customer usage limit reached"
+	// 訪客無法追蹤個人使用次數
+	reasonSignInRequired = "sign-in required for per-customer limited discount"
+)
+
+// 用戶對單一折扣的使用狀況
+type UserDiscountUsage struct {
+	DiscountID      int64  `json:"discount_id"`
+	DiscountName    string `json:"discount_name"`
+	MaxUsagePerUser int    `json:"max_usage_per_user"`
+	Used            int    `json:"used"`
+	Remaining       *int   `json:"remaining"` // 為 null 時不限次數
+}
+
+// RecordRedemptions 寫入訂單套用折扣的使用紀錄，超過個人使用上限時回傳 ErrDiscountUserLimitExceeded
+func (s *DiscountService) RecordRedemptions(ctx context.Context, redemptions []models.DiscountRedemption) error {
+	if len(redemptions) == 0 {
+		return nil
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 檢查與寫入在同一個交易中，資料庫的寫入鎖確保同一用戶的並行結帳不會超過上限
+		for _, redemption := range redemptions {
+			var discount models.Discount
+			if err := tx.First(&discount, redemption.DiscountID).Error; err != nil {
+				return err
+			}
+			if discount.MaxUsagePerUser == 0 {
+				continue
+			}
+			if redemption.UserID == 0 {
+				return fmt.Errorf("%w: discount %d requires a signed-in user", ErrDiscountUserLimitExceeded, discount.ID)
+			}
+
+			var used int64
+			err := tx.Model(&models.DiscountRedemption{}).
+				Where("user_id = ? AND discount_id = ? AND reversed_at IS NULL", redemption.UserID, discount.ID).
+				Count(&used).Error
+			if err != nil {
+				return err
+			}
+			if used >= int64(discount.MaxUsagePerUser) {
+				return fmt.Errorf("%w: discount %d", ErrDiscountUserLimitExceeded, discount.ID)
+			}
+		}
+
+		now := time.Now()
+		for i := range redemptions {
+			redemptions[i].CreatedAt = now
+		}
+		return tx.Create(&redemptions).Error
+	})
+}
+
+// ReverseRedemptions 沖銷訂單的使用紀錄，並歸還折扣與優惠碼的使用次數
+func (s *DiscountService) ReverseRedemptions(ctx context.Context, orderID int64, reason string) ([]models.DiscountRedemption, error) {
+	var reversed []models.DiscountRedemption
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("order_id = ? AND reversed_at IS NULL", orderID).Order("id").Find(&reversed).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		couponIDs := make([]int64, 0, len(reversed))
+		for i := range reversed {
+			redemption := &reversed[i]
+
+			// 以 reversed_at 作為條件，避免重複沖銷
+			result := tx.Model(&models.DiscountRedemption{}).
+				Where("id = ? AND reversed_at IS NULL", redemption.ID).
+				Updates(map[string]interface{}{"reversed_at": now, "reversal_reason": reason})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			redemption.ReversedAt = &now
+			redemption.ReversalReason = reason
+
+			// 結帳時只有設有上限的折扣會遞增使用次數
+			err := tx.Model(&models.Discount{}).
+				Where("id = ? AND max_usage > 0 AND usage_count > 0", redemption.DiscountID).
+				UpdateColumn("usage_count", gorm.Expr("usage_count - 1")).Error
+			if err != nil {
+				return err
+			}
+			if redemption.CouponID != 0 {
+				couponIDs = append(couponIDs, redemption.CouponID)
+			}
+		}
+
+		return NewCouponService(tx).ReleaseCoupons(ctx, couponIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reversed, nil
+}
+
+// GetUserDiscountUsage 回傳用戶對目前有效折扣的使用次數與剩餘次數
+func (s *DiscountService) GetUserDiscountUsage(ctx context.Context, userID int64) ([]UserDiscountUsage, error) {
+	discounts, err := s.activeDiscounts(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.userRedemptionCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]UserDiscountUsage, len(discounts))
+	for i, discount := range discounts {
+		usage := UserDiscountUsage{
+			DiscountID:      discount.ID,
+			DiscountName:    discount.Name,
+			MaxUsagePerUser: discount.MaxUsagePerUser,
+			Used:            counts[discount.ID],
+		}
+
+		// 剩餘次數同時受個人上限與整體上限限制，結帳中保留的名額也計入整體上限
+		remaining := -1
+		if discount.MaxUsagePerUser > 0 {
+			remaining = max(discount.MaxUsagePerUser-usage.Used, 0)
+		}
+		if discount.MaxUsage > 0 {
+			global := max(discount.MaxUsage-discount.UsageCount-discount.ReservedCount, 0)
+			if remaining < 0 || global < remaining {
+				remaining = global
+			}
+		}
+		if remaining >= 0 {
+			usage.Remaining = &remaining
+		}
+
+		usages[i] = usage
+	}
+	return usages, nil
+}
+
+// userRedemptionCounts 查詢用戶各折扣的使用次數，訪客回傳空集合
+func (s *DiscountService) userRedemptionCounts(ctx context.Context, userID int64) (map[int64]int, error) {
+	counts := make(map[int64]int)
+	if userID == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		DiscountID int64
+		Used       int
+	}
+	err := s.db.WithContext(ctx).Model(&models.DiscountRedemption{}).
+		Select("discount_id, COUNT(*) AS used").
+		Where("user_id = ? AND reversed_at IS NULL", userID).
+		Group("discount_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.DiscountID] = row.Used
+	}
+	return counts, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerUserUsageLimit(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:            "Once Per Customer",
+		Type:            models.Fixed,
+		Value:           dec("10"),
+		StartDate:       now.Add(-1 * time.Hour),
+		EndDate:         now.Add(24 * time.Hour),
+		MaxUsage:        10,
+		MaxUsagePerUser: 1,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 1}}
+	checkout := func(userID int64) error {
+		cart, err := cartService.CreateCart(ctx, userID)
+		assert.NoError(t, err)
+		_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+		assert.NoError(t, err)
+		_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+		return err
+	}
+
+	available, err := discountService.FindAvailableDiscounts(ctx, DiscountQuery{UserID: 1, Lines: lines})
+	assert.NoError(t, err)
+	assert.Len(t, available, 1)
+
+	// 第一次結帳寫入使用紀錄
+	assert.NoError(t, checkout(1))
+
+	var redemptions []models.DiscountRedemption
+	db.Find(&redemptions)
+	assert.Len(t, redemptions, 1)
+	assert.Equal(t, int64(1), redemptions[0].UserID)
+	assert.NotZero(t, redemptions[0].OrderID)
+
+	// 同一用戶已用完，其他用戶仍可使用
+	available, err = discountService.FindAvailableDiscounts(ctx, DiscountQuery{UserID: 1, Lines: lines})
+	assert.NoError(t, err)
+	assert.Empty(t, available)
+
+	application, err := discountService.ApplyDiscounts(ctx, ApplyDiscountInput{UserID: 1, Lines: lines})
+	assert.NoError(t, err)
+	assert.Equal(t, "per-customer usage limit reached", application.Rejected[0].Reason)
+
+	assert.ErrorIs(t, checkout(1), ErrDiscountUserLimitExceeded)
+	assert.NoError(t, checkout(2))
+
+	// 使用紀錄記在各購物車的用戶，不影響其他用戶的次數
+	var counts []struct {
+		UserID int64
+		Used   int
+	}
+	db.Model(&models.DiscountRedemption{}).Select("user_id, COUNT(*) AS used").Group("user_id").Order("user_id").Scan(&counts)
+	assert.Len(t, counts, 2)
+	assert.Equal(t, int64(1), counts[0].UserID)
+	assert.Equal(t, 1, counts[0].Used)
+	assert.Equal(t, int64(2), counts[1].UserID)
+	assert.Equal(t, 1, counts[1].Used)
+
+	// 訪客無法使用有個人上限的折扣
+	available, err = discountService.FindAvailableDiscounts(ctx, DiscountQuery{Lines: lines})
+	assert.NoError(t, err)
+	assert.Empty(t, available)
+
+	// 直接寫入超過上限的紀錄會失敗
+	err = discountService.RecordRedemptions(ctx, []models.DiscountRedemption{{DiscountID: discount.ID, UserID: 2, OrderID: 99}})
+	assert.ErrorIs(t, err, ErrDiscountUserLimitExceeded)
+}
+
+func TestGetUserDiscountUsage(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newDiscount := func(name string, maxUsage, usageCount, maxPerUser int) *models.Discount {
+		discount := &models.Discount{
+			Name:            name,
+			Type:            models.Fixed,
+			Value:           dec("10"),
+			StartDate:       now.Add(-1 * time.Hour),
+			EndDate:         now.Add(24 * time.Hour),
+			MaxUsage:        maxUsage,
+			UsageCount:      usageCount,
+			MaxUsagePerUser: maxPerUser,
+		}
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+		return discount
+	}
+
+	perUser := newDiscount("Three Per Customer", 0, 0, 3)
+	globalOnly := newDiscount("Limited", 10, 8, 0)
+	reserved := newDiscount("Reserved", 10, 7, 0)
+	bothLimits := newDiscount("Nearly Gone", 5, 4, 3)
+	unlimited := newDiscount("Unlimited", 0, 0, 0)
+
+	db.Model(reserved).Update("reserved_count", 2)
+
+	assert.NoError(t, service.RecordRedemptions(ctx, []models.DiscountRedemption{
+		{DiscountID: perUser.ID, UserID: 1, OrderID: 1},
+		{DiscountID: unlimited.ID, UserID: 1, OrderID: 1},
+	}))
+
+	usages, err := service.GetUserDiscountUsage(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, usages, 5)
+
+	byID := make(map[int64]UserDiscountUsage, len(usages))
+	for _, usage := range usages {
+		byID[usage.DiscountID] = usage
+	}
+
+	assert.Equal(t, 1, byID[perUser.ID].Used)
+	assert.Equal(t, 2, *byID[perUser.ID].Remaining)
+	assert.Equal(t, 2, *byID[globalOnly.ID].Remaining)
+	assert.Equal(t, 1, *byID[reserved.ID].Remaining) // 結帳中保留的名額不可再使用
+	assert.Equal(t, 1, *byID[bothLimits.ID].Remaining)
+	assert.Equal(t, 1, byID[unlimited.ID].Used)
+	assert.Nil(t, byID[unlimited.ID].Remaining)
+}
+
+func TestReverseRedemptionsOnCancelAndRefund(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	couponService := NewCouponService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	limited := &models.Discount{
+		Name:            "Last One 10 Off",
+		Type:            models.Fixed,
+		Value:           dec("10"),
+		StartDate:       now.Add(-1 * time.Hour),
+		EndDate:         now.Add(24 * time.Hour),
+		Stackable:       true,
+		MaxUsage:        1,
+		MaxUsagePerUser: 1,
+	}
+	couponOnly := &models.Discount{
+		Name:           "Coupon 5%",
+		Type:           models.Percentage,
+		Value:          dec("5"),
+		StartDate:      now.Add(-1 * time.Hour),
+		EndDate:        now.Add(24 * time.Hour),
+		Stackable:      true,
+		RequiresCoupon: true,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, limited))
+	assert.NoError(t, discountService.CreateDiscount(ctx, couponOnly))
+	coupon := &models.Coupon{DiscountID: couponOnly.ID, Code: "SINGLE", MaxRedemptions: 1}
+	assert.NoError(t, couponService.CreateCoupon(ctx, coupon))
+
+	checkout := func(userID int64) (*models.Order, error) {
+		cart, err := cartService.CreateCart(ctx, userID)
+		assert.NoError(t, err)
+		_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("200"), Quantity: 1})
+		assert.NoError(t, err)
+		_, err = couponService.ApplyCoupon(ctx, cart.ID, "SINGLE")
+		assert.NoError(t, err)
+		return checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{limited.ID, couponOnly.ID}})
+	}
+
+	order, err := checkout(1)
+	assert.NoError(t, err)
+
+	var redemptions []models.DiscountRedemption
+	db.Where("order_id = ?", order.ID).Order("discount_id").Find(&redemptions)
+	assert.Len(t, redemptions, 2)
+	assert.Equal(t, dec("10"), redemptions[0].AmountSaved)
+	assert.Equal(t, coupon.ID, redemptions[1].CouponID)
+	assert.Equal(t, dec("9.5"), redemptions[1].AmountSaved)
+
+	// 取消訂單後折扣與優惠碼的使用次數都被歸還
+	cancelled, err := checkoutService.CancelOrder(ctx, order.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderCancelled, cancelled.Status)
+
+	var updated models.Discount
+	db.First(&updated, limited.ID)
+	assert.Equal(t, 0, updated.UsageCount)
+	var released models.Coupon
+	db.First(&released, coupon.ID)
+	assert.Equal(t, 0, released.RedemptionCount)
+
+	db.Where("order_id = ?", order.ID).Find(&redemptions)
+	for _, redemption := range redemptions {
+		assert.NotNil(t, redemption.ReversedAt)
+		assert.Equal(t, "CANCELLED", redemption.ReversalReason)
+	}
+
+	// 已取消的訂單不可再次沖銷
+	_, err = checkoutService.RefundOrder(ctx, order.ID)
+	assert.ErrorIs(t, err, ErrOrderNotReversible)
+
+	// 同一用戶可以再次使用個人限用一次的折扣
+	order, err = checkout(1)
+	assert.NoError(t, err)
+	db.First(&updated, limited.ID)
+	assert.Equal(t, 1, updated.UsageCount)
+
+	refunded, err := checkoutService.RefundOrder(ctx, order.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderRefunded, refunded.Status)
+	db.First(&updated, limited.ID)
+	assert.Equal(t, 0, updated.UsageCount)
+
+	usages, err := discountService.GetUserDiscountUsage(ctx, 1)
+	assert.NoError(t, err)
+	for _, usage := range usages {
+		assert.Equal(t, 0, usage.Used)
+	}
+}
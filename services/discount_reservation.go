@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+// ReserveDiscounts 為購物車保留限量折扣的使用名額，保留期間計入最大使用次數。
+// 購物車已保留的折扣只延長期限；任一折扣名額不足時回傳 *DiscountExhaustedError 且不保留任何名額
+func (s *DiscountService) ReserveDiscounts(ctx context.Context, cartID, userID int64, discountIDs []int64, ttl time.Duration) ([]models.DiscountReservation, error) {
+	var reservations []models.DiscountReservation
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		expiresAt := now.Add(ttl)
+		exhausted := make([]int64, 0)
+		seen := make(map[int64]bool, len(discountIDs))
+
+		for _, id := range discountIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			var existing models.DiscountReservation
+			err := tx.Where("cart_id = ? AND discount_id = ? AND status = ?", cartID, id, models.ReservationHeld).
+				First(&existing).Error
+			if err == nil {
+				existing.ExpiresAt = expiresAt
+				if err := tx.Model(&existing).Updates(map[string]interface{}{"expires_at": expiresAt, "updated_at": now}).Error; err != nil {
+					return err
+				}
+				reservations = append(reservations, existing)
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			// 使用次數與保留次數的總和必須小於上限，比較與遞增在同一個 UPDATE 中完成
+			result := tx.Model(&models.Discount{}).
+				Where("id = ? AND max_usage > 0 AND usage_count + reserved_count < max_usage", id).
+				UpdateColumn("reserved_count", gorm.Expr("reserved_count + 1"))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// 沒有上限的折扣不需要保留
+				var limited int64
+				if err := tx.Model(&models.Discount{}).Where("id = ? AND max_usage > 0", id).Count(&limited).Error; err != nil {
+					return err
+				}
+				if limited > 0 {
+					exhausted = append(exhausted, id)
+				}
+				continue
+			}
+
+			reservation := models.DiscountReservation{
+				DiscountID: id,
+				CartID:     cartID,
+				UserID:     userID,
+				Status:     models.ReservationHeld,
+				ExpiresAt:  expiresAt,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			if err := tx.Create(&reservation).Error; err != nil {
+				return err
+			}
+			reservations = append(reservations, reservation)
+		}
+
+		if len(exhausted) > 0 {
+			return &DiscountExhaustedError{DiscountIDs: exhausted}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// ConfirmReservations 將購物車對指定折扣的保留轉為正式使用次數，回傳已確認的折扣ID。
+// 購物車其他未使用的保留會一併釋放
+func (s *DiscountService) ConfirmReservations(ctx context.Context, cartID int64, discountIDs []int64) ([]int64, error) {
+	wanted := make(map[int64]bool, len(discountIDs))
+	for _, id := range discountIDs {
+		wanted[id] = true
+	}
+
+	confirmed := make([]int64, 0, len(discountIDs))
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		held, err := heldReservations(tx, "cart_id = ?", cartID)
+		if err != nil {
+			return err
+		}
+
+		for _, reservation := range held {
+			if !wanted[reservation.DiscountID] {
+				if err := settleReservation(tx, &reservation, models.ReservationReleased); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := settleReservation(tx, &reservation, models.ReservationConfirmed); err != nil {
+				return err
+			}
+			confirmed = append(confirmed, reservation.DiscountID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return confirmed, nil
+}
+
+// ReleaseReservations 釋放購物車所有保留中的名額
+func (s *DiscountService) ReleaseReservations(ctx context.Context, cartID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		held, err := heldReservations(tx, "cart_id = ?", cartID)
+		if err != nil {
+			return err
+		}
+		for _, reservation := range held {
+			if err := settleReservation(tx, &reservation, models.ReservationReleased); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ExpireReservations 釋放在指定時間前已逾時的保留，回傳釋放的數量
+func (s *DiscountService) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	expired := 0
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		held, err := heldReservations(tx, "expires_at <= ?", now)
+		if err != nil {
+			return err
+		}
+		for _, reservation := range held {
+			if err := settleReservation(tx, &reservation, models.ReservationExpired); err != nil {
+				return err
+			}
+			expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// StartReservationSweeper 在背景定期釋放逾時的保留，ctx 取消時停止
+func (s *DiscountService) StartReservationSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				expired, err := s.ExpireReservations(ctx, now)
+				if err != nil {
+					log.Printf("釋放逾時的折扣保留失敗: %v", err)
+					continue
+				}
+				if expired > 0 {
+					log.Printf("已釋放 %d 個逾時的折扣保留", expired)
+				}
+			}
+		}
+	}()
+}
+
+// heldReservedDiscountIDs 查詢購物車保留中的折扣，保留在被 sweeper 釋放前都有效
+func (s *DiscountService) heldReservedDiscountIDs(ctx context.Context, cartID int64) (map[int64]bool, error) {
+	ids := make(map[int64]bool)
+	if cartID == 0 {
+		return ids, nil
+	}
+
+	var discountIDs []int64
+	err := s.db.WithContext(ctx).Model(&models.DiscountReservation{}).
+		Where("cart_id = ? AND status = ?", cartID, models.ReservationHeld).
+		Pluck("discount_id", &discountIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range discountIDs {
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+func heldReservations(tx *gorm.DB, query string, args ...interface{}) ([]models.DiscountReservation, error) {
+	var held []models.DiscountReservation
+	err := tx.Where("status = ?", models.ReservationHeld).
+		Where(query, args...).
+		Order("id").
+		Find(&held).Error
+	return held, err
+}
+
+// settleReservation 結束保留並歸還名額，確認時同時轉為使用次數
+func settleReservation(tx *gorm.DB, reservation *models.DiscountReservation, status models.ReservationStatus) error {
+	// 以狀態作為條件，避免同一個保留被重複結算
+	result := tx.Model(&models.DiscountReservation{}).
+		Where("id = ? AND status = ?", reservation.ID, models.ReservationHeld).
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	reservation.Status = status
+
+	updates := map[string]interface{}{"reserved_count": gorm.Expr("reserved_count - 1")}
+	if status == models.ReservationConfirmed {
+		updates["usage_count"] = gorm.Expr("usage_count + 1")
+	}
+	return tx.Model(&models.Discount{}).
+		Where("id = ? AND reserved_count > 0", reservation.DiscountID).
+		UpdateColumns(updates).Error
+}
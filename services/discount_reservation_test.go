@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckoutReservations(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:      "Only One 30 Off",
+		Type:      models.Fixed,
+		Value:     dec("30"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		MaxUsage:  1,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	newCart := func(userID int64) *models.Cart {
+		cart, err := cartService.CreateCart(ctx, userID)
+		assert.NoError(t, err)
+		cart, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+		assert.NoError(t, err)
+		return cart
+	}
+	first, second := newCart(1), newCart(2)
+	expected := []int64{discount.ID}
+
+	// 第一台購物車開始結帳時保留唯一的名額
+	session, err := checkoutService.StartCheckout(ctx, CheckoutInput{CartID: first.ID, ExpectedDiscountIDs: expected})
+	assert.NoError(t, err)
+	assert.Len(t, session.Reservations, 1)
+	assert.Equal(t, models.ReservationHeld, session.Reservations[0].Status)
+	assert.Equal(t, dec("70"), session.Application.Total)
+
+	var updated models.Discount
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 1, updated.ReservedCount)
+
+	// 保留期間其他購物車看不到此折扣，也無法保留
+	available, err := discountService.FindAvailableDiscounts(ctx, DiscountQuery{UserID: 2, Lines: CartLines(second)})
+	assert.NoError(t, err)
+	assert.Empty(t, available)
+
+	_, err = checkoutService.StartCheckout(ctx, CheckoutInput{CartID: second.ID, ExpectedDiscountIDs: expected})
+	assert.ErrorIs(t, err, ErrDiscountUsageExceeded)
+
+	// 重複開始結帳只延長保留
+	_, err = checkoutService.StartCheckout(ctx, CheckoutInput{CartID: first.ID, ExpectedDiscountIDs: expected})
+	assert.NoError(t, err)
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 1, updated.ReservedCount)
+
+	// 付款後保留轉為使用次數
+	order, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: first.ID, ExpectedDiscountIDs: expected})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("70"), order.Total)
+
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 1, updated.UsageCount)
+	assert.Equal(t, 0, updated.ReservedCount)
+
+	var reservation models.DiscountReservation
+	db.Where("cart_id = ?", first.ID).First(&reservation)
+	assert.Equal(t, models.ReservationConfirmed, reservation.Status)
+}
+
+func TestReleaseAndExpireReservations(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:      "Limited 10%",
+		Type:      models.Percentage,
+		Value:     dec("10"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		MaxUsage:  1,
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, discount))
+
+	cart, _ := cartService.CreateCart(ctx, 1)
+	_, err := cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+	assert.NoError(t, err)
+	other, _ := cartService.CreateCart(ctx, 2)
+	_, err = cartService.AddItem(ctx, other.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+	assert.NoError(t, err)
+
+	var updated models.Discount
+
+	// 放棄結帳時歸還名額
+	_, err = checkoutService.StartCheckout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.NoError(t, err)
+	assert.NoError(t, checkoutService.CancelCheckout(ctx, cart.ID))
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 0, updated.ReservedCount)
+
+	// 逾時的保留被釋放後，名額可以給其他購物車
+	_, err = checkoutService.StartCheckout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.NoError(t, err)
+
+	expired, err := discountService.ExpireReservations(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, expired)
+
+	expired, err = discountService.ExpireReservations(ctx, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 0, updated.ReservedCount)
+
+	_, err = checkoutService.StartCheckout(ctx, CheckoutInput{CartID: other.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.NoError(t, err)
+
+	// 原購物車的保留已過期，付款時折扣已被其他購物車保留
+	_, err = checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{discount.ID}})
+	assert.ErrorIs(t, err, ErrDiscountUsageExceeded)
+}
+
+func TestReservationSweeper(t *testing.T) {
+	db := setupConcurrentTestDB(t)
+	service := NewDiscountService(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now()
+
+	discount := &models.Discount{Name: "Flash", Type: models.Fixed, Value: dec("5"), StartDate: now, EndDate: now.Add(time.Hour), MaxUsage: 3}
+	assert.NoError(t, service.CreateDiscount(ctx, discount))
+
+	_, err := service.ReserveDiscounts(ctx, 1, 1, []int64{discount.ID}, time.Millisecond)
+	assert.NoError(t, err)
+
+	service.StartReservationSweeper(ctx, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		var updated models.Discount
+		db.First(&updated, discount.ID)
+		return updated.ReservedCount == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	var reservation models.DiscountReservation
+	db.First(&reservation)
+	assert.Equal(t, models.ReservationExpired, reservation.Status)
+}
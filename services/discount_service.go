@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"sort"
 	"time"
@@ -10,20 +11,124 @@ import (
 	"shopping_cart/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrDiscountUsageExceeded = errors.New("discount usage limit reached")
+	ErrClientTotalRejected   = errors.New("client-provided cart total is not accepted, use the cart or its line items")
+)
+
+// DiscountExhaustedError 列出已達使用上限的折扣，可用 errors.Is(err, ErrDiscountUsageExceeded) 判斷
+type DiscountExhaustedError struct {
+	DiscountIDs []int64
+}
+
+func (e *DiscountExhaustedError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrDiscountUsageExceeded, e.DiscountIDs)
+}
+
+func (e *DiscountExhaustedError) Is(target error) bool {
+	return target == ErrDiscountUsageExceeded
+}
+
 type DiscountService struct {
-	db *gorm.DB
+	db         *gorm.DB
+	membership MembershipProvider
+	rounding   models.RoundingMode
+	rates      ExchangeRateProvider // 未設定時不換算，貨幣不同的折扣不適用
+	// 折扣後明細與購物車的最低應付金額
+	minLineTotal models.Decimal
+	minCartTotal models.Decimal
+	// 不接受呼叫端提供的購物車總額，只以明細計算，避免偽造金額取得門檻折扣
+	rejectClientTotals bool
 }
 
 func NewDiscountService(db *gorm.DB) *DiscountService {
-	return &DiscountService{db: db}
+	return &DiscountService{db: db, membership: NewMembershipService(db)}
+}
+
+// WithMembershipProvider 回傳使用指定會員等級來源的 DiscountService
+func (s *DiscountService) WithMembershipProvider(provider MembershipProvider) *DiscountService {
+	clone := *s
+	clone.membership = provider
+	return &clone
+}
+
+// WithRounding 回傳計算折扣時使用指定捨入模式的 DiscountService，預設為四捨五入
+func (s *DiscountService) WithRounding(mode models.RoundingMode) *DiscountService {
+	clone := *s
+	clone.rounding = mode
+	return &clone
+}
+
+// WithPriceFloors 回傳折扣後明細與購物車金額不低於指定下限的 DiscountService
+func (s *DiscountService) WithPriceFloors(minLineTotal, minCartTotal models.Decimal) *DiscountService {
+	clone := *s
+	clone.minLineTotal = minLineTotal
+	clone.minCartTotal = minCartTotal
+	return &clone
+}
+
+// pricingEngine 依服務的捨入模式與金額下限建立計價引擎
+func (s *DiscountService) pricingEngine() *PricingEngine {
+	return NewPricingEngine().WithRounding(s.rounding).WithPriceFloors(s.minLineTotal, s.minCartTotal)
+}
+
+// WithExchangeRates 回傳以指定匯率換算不同貨幣折扣的 DiscountService
+func (s *DiscountService) WithExchangeRates(rates ExchangeRateProvider) *DiscountService {
+	clone := *s
+	clone.rates = rates
+	return &clone
+}
+
+// WithClientTotals 回傳是否接受呼叫端提供購物車總額 (DiscountQuery.CartTotal、ApplyDiscountInput.CartTotal) 的 DiscountService，
+// 預設接受，正式環境應關閉
+func (s *DiscountService) WithClientTotals(allowed bool) *DiscountService {
+	clone := *s
+	clone.rejectClientTotals = !allowed
+	return &clone
+}
+
+// WithTx 回傳在指定交易中操作的 DiscountService
+func (s *DiscountService) WithTx(tx *gorm.DB) *DiscountService {
+	clone := *s
+	clone.db = tx
+	// 預設的會員服務也必須在同一個交易中查詢
+	if _, ok := s.membership.(*MembershipService); ok {
+		clone.membership = NewMembershipService(tx)
+	}
+	return &clone
 }
 
 func (s *DiscountService) CreateDiscount(ctx context.Context, discount *models.Discount) error {
 	if discount.StartDate.After(discount.EndDate) {
 		return errors.New("start date cannot be after end date")
 	}
+	if discount.MaxSavings.IsNegative() {
+		return errors.New("max savings cannot be negative")
+	}
+	if err := validateBOGORule(discount.BOGORule); err != nil {
+		return err
+	}
+	if err := validateDiscountTiers(discount); err != nil {
+		return err
+	}
+	if err := validateBundle(discount); err != nil {
+		return err
+	}
+	if err := validateGift(discount); err != nil {
+		return err
+	}
+	if err := validateDiscountTargets(discount); err != nil {
+		return err
+	}
+
+	currency, err := models.ParseCurrency(string(discount.Currency))
+	if err != nil {
+		return err
+	}
+	discount.Currency = currency
 
 	discount.CreatedAt = time.Now()
 	discount.UpdatedAt = time.Now()
@@ -31,110 +136,371 @@ func (s *DiscountService) CreateDiscount(ctx context.Context, discount *models.D
 	return s.db.WithContext(ctx).Create(discount).Error
 }
 
+// UpdateDiscount 更新折扣，並以 discount 回傳更新後的完整內容。
+// 規則、條件、商品、階梯、組合、適用範圍與各貨幣金額等子設定有提供時整組取代 (空陣列為清除)，未提供時保留原本的設定
 func (s *DiscountService) UpdateDiscount(ctx context.Context, id int64, discount *models.Discount) error {
-	existing := &models.Discount{}
-	if err := s.db.WithContext(ctx).First(existing, id).Error; err != nil {
+	existing, err := s.loadDiscount(s.db.WithContext(ctx), id)
+	if err != nil {
 		return err
 	}
 
 	if discount.StartDate.After(discount.EndDate) {
 		return errors.New("start date cannot be after end date")
 	}
+	if discount.MaxSavings.IsNegative() {
+		return errors.New("max savings cannot be negative")
+	}
+
+	// 以合併後的設定檢查，未提供的部分沿用既有的內容
+	merged := mergeDiscountSettings(existing, discount)
+	if err := validateBOGORule(merged.BOGORule); err != nil {
+		return err
+	}
+	if err := validateDiscountTiers(merged); err != nil {
+		return err
+	}
+	if err := validateBundle(merged); err != nil {
+		return err
+	}
+	if err := validateGift(merged); err != nil {
+		return err
+	}
+	if err := validateDiscountTargets(merged); err != nil {
+		return err
+	}
+	if discount.Currency != "" {
+		currency, err := models.ParseCurrency(string(discount.Currency))
+		if err != nil {
+			return err
+		}
+		discount.Currency = currency
+	}
 
 	discount.UpdatedAt = time.Now()
-	return s.db.WithContext(ctx).Model(existing).Updates(discount).Error
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(existing).Omit(clause.Associations).Updates(discount).Error; err != nil {
+			return err
+		}
+		return replaceDiscountSettings(tx, id, discount)
+	})
+	if err != nil {
+		return err
+	}
+
+	updated, err := s.loadDiscount(s.db.WithContext(ctx), id)
+	if err != nil {
+		return err
+	}
+	*discount = *updated
+	return nil
+}
+
+// mergeDiscountSettings 回傳以 update 覆蓋 existing 後的折扣，用於更新前的檢查
+func mergeDiscountSettings(existing, update *models.Discount) *models.Discount {
+	merged := *update
+	if merged.Type == "" {
+		merged.Type = existing.Type
+	}
+	if merged.Value.IsZero() {
+		merged.Value = existing.Value
+	}
+	if merged.BundlePrice.IsZero() {
+		merged.BundlePrice = existing.BundlePrice
+	}
+	if merged.BOGORule == nil {
+		merged.BOGORule = existing.BOGORule
+	}
+	if merged.Conditions == nil {
+		merged.Conditions = existing.Conditions
+	}
+	if merged.Products == nil {
+		merged.Products = existing.Products
+	}
+	if merged.Targets == nil {
+		merged.Targets = existing.Targets
+	}
+	if merged.CurrencyValues == nil {
+		merged.CurrencyValues = existing.CurrencyValues
+	}
+	if merged.BundleItems == nil {
+		merged.BundleItems = existing.BundleItems
+	}
+	if merged.Tiers == nil {
+		merged.Tiers = existing.Tiers
+	}
+	return &merged
+}
+
+// replaceDiscountSettings 刪除折扣既有的子設定並寫入 discount 提供的內容，未提供的子設定不變
+func replaceDiscountSettings(tx *gorm.DB, discountID int64, discount *models.Discount) error {
+	if discount.BOGORule != nil {
+		rule := *discount.BOGORule
+		rule.ID, rule.DiscountID = 0, discountID
+		if err := replaceDiscountRows(tx, discountID, &models.BOGORule{}, []models.BOGORule{rule}, 1); err != nil {
+			return err
+		}
+	}
+	if discount.Conditions != nil {
+		rows := make([]models.DiscountCondition, len(discount.Conditions))
+		for i, row := range discount.Conditions {
+			row.ID, row.DiscountID = 0, discountID
+			rows[i] = row
+		}
+		if err := replaceDiscountRows(tx, discountID, &models.DiscountCondition{}, rows, len(rows)); err != nil {
+			return err
+		}
+	}
+	if discount.Products != nil {
+		rows := make([]models.DiscountProduct, len(discount.Products))
+		for i, row := range discount.Products {
+			row.ID, row.DiscountID = 0, discountID
+			rows[i] = row
+		}
+		if err := replaceDiscountRows(tx, discountID, &models.DiscountProduct{}, rows, len(rows)); err != nil {
+			return err
+		}
+	}
+	if discount.Targets != nil {
+		rows := make([]models.DiscountTarget, len(discount.Targets))
+		for i, row := range discount.Targets {
+			row.ID, row.DiscountID = 0, discountID
+			rows[i] = row
+		}
+		if err := replaceDiscountRows(tx, discountID, &models.DiscountTarget{}, rows, len(rows)); err != nil {
+			return err
+		}
+	}
+	if discount.CurrencyValues != nil {
+		rows := make([]models.DiscountCurrencyValue, len(discount.CurrencyValues))
+		for i, row := range discount.CurrencyValues {
+			row.ID, row.DiscountID = 0, discountID
+			rows[i] = row
+		}
+		if err := replaceDiscountRows(tx, discountID, &models.DiscountCurrencyValue{}, rows, len(rows)); err != nil {
+			return err
+		}
+	}
+	if discount.BundleItems != nil {
+		rows := make([]models.BundleItem, len(discount.BundleItems))
+		for i, row := range discount.BundleItems {
+			row.ID, row.DiscountID = 0, discountID
+			rows[i] = row
+		}
+		if err := replaceDiscountRows(tx, discountID, &models.BundleItem{}, rows, len(rows)); err != nil {
+			return err
+		}
+	}
+	if discount.Tiers != nil {
+		rows := make([]models.DiscountTier, len(discount.Tiers))
+		for i, row := range discount.Tiers {
+			row.ID, row.DiscountID = 0, discountID
+			rows[i] = row
+		}
+		if err := replaceDiscountRows(tx, discountID, &models.DiscountTier{}, rows, len(rows)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceDiscountRows 刪除 model 資料表中屬於折扣的資料，再寫入 rows (共 n 筆)
+func replaceDiscountRows(tx *gorm.DB, discountID int64, model, rows interface{}, n int) error {
+	if err := tx.Where("discount_id = ?", discountID).Delete(model).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	return tx.Create(rows).Error
 }
 
 func (s *DiscountService) DeleteDiscount(ctx context.Context, id int64) error {
 	return s.db.WithContext(ctx).Delete(&models.Discount{}, id).Error
 }
 
-func (s *DiscountService) GetAvailableDiscounts(ctx context.Context, userID int64, cartTotal float64, productIDs []int64) ([]models.Discount, error) {
-	var discounts []models.Discount
-	now := time.Now()
+// 查詢可用折扣時的購物車資訊
+type DiscountQuery struct {
+	UserID    int64
+	CartTotal models.Decimal
+	Lines     []CartLine
+	Currency  models.Currency // 空白時使用預設貨幣
+}
 
-	// 輸出調試信息以檢查SQL查詢
-	log.Printf("查詢折扣，用戶ID: %d, 購物車總額: %f, 商品IDs: %v", userID, cartTotal, productIDs)
+// GetAvailableDiscounts 以商品ID查詢可用折扣，每個商品視為購買一件
+func (s *DiscountService) GetAvailableDiscounts(ctx context.Context, userID int64, cartTotal models.Decimal, productIDs []int64) ([]models.Discount, error) {
+	lines := make([]CartLine, len(productIDs))
+	for i, id := range productIDs {
+		lines[i] = CartLine{ProductID: id, Quantity: 1}
+	}
 
-	// 獲取所有有效折扣
-	query := s.db.WithContext(ctx).Debug(). // 添加 Debug() 以記錄 SQL 查詢
-						Where("start_date <= ? AND end_date >= ?", now, now)
+	return s.FindAvailableDiscounts(ctx, DiscountQuery{UserID: userID, CartTotal: cartTotal, Lines: lines})
+}
 
-	// 根據用戶條件過濾
-	if userID != 0 {
-		query = query.Joins("JOIN discount_conditions ON discount_conditions.discount_id = discounts.id").
-			Where("discount_conditions.type = ? AND discount_conditions.value = ?", models.MembershipLevel, "GOLD")
+// FindAvailableDiscounts 查詢符合購物車內容的可用折扣
+// 每個折扣個別評估：所有條件都必須通過 (AND)，沒有條件的折扣無條件適用
+func (s *DiscountService) FindAvailableDiscounts(ctx context.Context, q DiscountQuery) ([]models.Discount, error) {
+	if s.rejectClientTotals && !q.CartTotal.IsZero() {
+		return nil, ErrClientTotalRejected
+	}
+	cartTotal := q.CartTotal
+	if !cartTotal.IsPositive() {
+		cartTotal = linesTotal(q.Lines)
 	}
 
-	// 根據購物車總金額過濾
-	if cartTotal > 0 {
-		// 使用原始SQL進行JOIN和條件處理
-		query = query.Joins("JOIN discount_conditions ON discount_conditions.discount_id = discounts.id").
-			Where("(discount_conditions.type = ? AND CAST(discount_conditions.value AS DECIMAL) <= ?)",
-				models.CartTotal, cartTotal)
+	// 輸出調試信息
+	log.Printf("查詢折扣，用戶ID: %d, 購物車總額: %s, 商品數: %d", q.UserID, cartTotal, len(q.Lines))
+
+	// 獲取所有有效折扣
+	discounts, err := s.activeDiscounts(ctx, time.Now())
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("查詢到 %d 個有效折扣", len(discounts))
 
-	// 根據商品ID過濾
-	if len(productIDs) > 0 {
-		query = query.Joins("JOIN discount_products ON discount_products.discount_id = discounts.id").
-			Where("discount_products.product_id IN ?", productIDs)
+	// 根據用戶的會員等級過濾
+	tier, err := s.membership.GetMembershipTier(ctx, q.UserID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 執行查詢
-	if err := query.Find(&discounts).Error; err != nil {
+	// 用戶已使用的次數，用於每位用戶的使用上限
+	redemptions, err := s.userRedemptionCounts(ctx, q.UserID)
+	if err != nil {
 		return nil, err
 	}
-	log.Printf("查詢到 %d 個有效折扣", len(discounts))
 
-	// 過濾已達最大使用次數的折扣
+	// 過濾已達最大使用次數、條件不符或購物車沒有適用商品的折扣
+	ec := EvaluationContext{Tier: tier, CartTotal: cartTotal, Lines: q.Lines, UserID: q.UserID, Redemptions: redemptions}
 	filteredDiscounts := make([]models.Discount, 0)
 	for _, discount := range discounts {
-		if discount.MaxUsage == 0 || discount.UsageCount < discount.MaxUsage {
-			filteredDiscounts = append(filteredDiscounts, discount)
-		} else {
+		// 以購物車的貨幣表示折扣金額與門檻，無法換算的折扣不適用
+		discount, err := localizeDiscount(discount, q.Currency, s.rates, s.rounding)
+		if err != nil {
 			continue
 		}
-	}
-
-	// 根據優先級和可疊加性排序 - 修正排序邏輯確保高優先級在前
-	sort.Slice(filteredDiscounts, func(i, j int) bool {
-		// 首先按優先級排序（數字越小優先級越高）
-		if filteredDiscounts[i].Priority != filteredDiscounts[j].Priority {
-			return filteredDiscounts[i].Priority < filteredDiscounts[j].Priority
+		if reason, _ := rejectionReason(&discount, ec); reason != "" {
+			continue
 		}
+		filteredDiscounts = append(filteredDiscounts, discount)
+	}
 
-		// 相同優先級時，不可疊加的折扣優先
-		return !filteredDiscounts[i].Stackable
-	})
+	// 根據優先級和可疊加性排序
+	sortDiscounts(filteredDiscounts)
 
 	// 移除了更新使用次數的部分，只在結帳時才更新使用次數
 
 	return filteredDiscounts, nil
 }
 
+// FindCartDiscounts 以購物車的商品查詢可用折扣，購物車總額由伺服器端依明細計算，不採用客戶端提供的金額
+func (s *DiscountService) FindCartDiscounts(ctx context.Context, cart *models.Cart) ([]models.Discount, error) {
+	return s.FindAvailableDiscounts(ctx, DiscountQuery{
+		UserID:   cart.UserID,
+		Lines:    CartLines(cart),
+		Currency: cart.Currency,
+	})
+}
+
+// preloadDiscountSettings 載入折扣的規則、條件、商品與其他子設定
+func preloadDiscountSettings(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Conditions").
+		Preload("Products").
+		Preload("CurrencyValues").
+		Preload("BOGORule").
+		Preload("BundleItems").
+		Preload("Targets").
+		Preload("Tiers", func(db *gorm.DB) *gorm.DB { return db.Order("min_quantity, min_spend") })
+}
+
+// loadDiscount 取得折扣及其所有子設定
+func (s *DiscountService) loadDiscount(db *gorm.DB, id int64) (*models.Discount, error) {
+	discount := &models.Discount{}
+	if err := preloadDiscountSettings(db).First(discount, id).Error; err != nil {
+		return nil, err
+	}
+	return discount, nil
+}
+
+// activeDiscounts 取得在有效期間內的折扣及其條件與商品
+func (s *DiscountService) activeDiscounts(ctx context.Context, now time.Time) ([]models.Discount, error) {
+	var discounts []models.Discount
+	err := preloadDiscountSettings(s.db.WithContext(ctx)).
+		Where("start_date <= ? AND end_date >= ?", now, now).
+		Order("id").
+		Find(&discounts).Error
+	return discounts, err
+}
+
 // 新增一個方法，用於結帳時更新折扣使用次數
+// 任何一個折扣已達使用上限時整批回滾，並回傳 *DiscountExhaustedError
 func (s *DiscountService) UpdateDiscountUsage(ctx context.Context, discountIDs []int64) error {
 	if len(discountIDs) == 0 {
 		return nil
 	}
 
-	// 使用交易確保更新的原子性
+	// 使用交易確保整批更新的原子性
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		var discounts []models.Discount
-		if err := tx.Find(&discounts, "id IN ?", discountIDs).Error; err != nil {
+		exhausted, err := s.WithTx(tx).IncrementDiscountUsage(ctx, discountIDs)
+		if err != nil {
 			return err
 		}
+		if len(exhausted) > 0 {
+			return &DiscountExhaustedError{DiscountIDs: exhausted}
+		}
+		return nil
+	})
+}
+
+// IncrementDiscountUsage 以條件式更新 (usage_count + reserved_count < max_usage) 遞增使用次數，
+// 回傳已達上限而未遞增的折扣ID。比較與遞增在同一個 UPDATE 中完成，並行結帳不會超賣
+func (s *DiscountService) IncrementDiscountUsage(ctx context.Context, discountIDs []int64) ([]int64, error) {
+	notUpdated := make([]int64, 0)
+	seen := make(map[int64]bool, len(discountIDs))
 
-		for _, discount := range discounts {
-			// 只更新有使用次數限制的折扣
-			if discount.MaxUsage > 0 {
-				discount.UsageCount++
-				if err := tx.Model(&discount).Update("usage_count", discount.UsageCount).Error; err != nil {
-					return err
-				}
-			}
+	for _, id := range discountIDs {
+		if seen[id] {
+			continue
 		}
+		seen[id] = true
 
-		return nil
+		// 只更新有使用次數限制的折扣，其他購物車保留中的名額也計入上限
+		result := s.db.WithContext(ctx).Model(&models.Discount{}).
+			Where("id = ? AND max_usage > 0 AND usage_count + reserved_count < max_usage", id).
+			UpdateColumn("usage_count", gorm.Expr("usage_count + 1"))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			notUpdated = append(notUpdated, id)
+		}
+	}
+
+	if len(notUpdated) == 0 {
+		return nil, nil
+	}
+
+	// 未更新的折扣中，有使用上限的才是已用完；無上限或不存在的折扣維持原本的略過行為
+	var exhausted []int64
+	err := s.db.WithContext(ctx).Model(&models.Discount{}).
+		Where("id IN ? AND max_usage > 0", notUpdated).
+		Order("id").
+		Pluck("id", &exhausted).Error
+	if err != nil {
+		return nil, err
+	}
+	return exhausted, nil
+}
+
+// sortDiscounts 依優先級排序，確保高優先級在前
+func sortDiscounts(discounts []models.Discount) {
+	sort.SliceStable(discounts, func(i, j int) bool {
+		// 首先按優先級排序（數字越小優先級越高）
+		if discounts[i].Priority != discounts[j].Priority {
+			return discounts[i].Priority < discounts[j].Priority
+		}
+
+		// 相同優先級時，不可疊加的折扣優先
+		return !discounts[i].Stackable && discounts[j].Stackable
 	})
 }
@@ -2,7 +2,10 @@ package services
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,6 +27,22 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.Discount{},
 		&models.DiscountCondition{},
 		&models.DiscountProduct{},
+		&models.DiscountCurrencyValue{},
+		&models.BOGORule{},
+		&models.DiscountTier{},
+		&models.BundleItem{},
+		&models.DiscountTarget{},
+		&models.Product{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderDiscount{},
+		&models.UserMembership{},
+		&models.Coupon{},
+		&models.CartCoupon{},
+		&models.DiscountRedemption{},
+		&models.DiscountReservation{},
 	); err != nil {
 		t.Fatalf("Failed to migrate database: %v", err)
 	}
@@ -31,6 +50,26 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	return db
 }
 
+// dec 將字串轉為 Decimal，方便撰寫金額與百分比
+func dec(value string) models.Decimal {
+	return models.MustParseDecimal(value)
+}
+
+// setupConcurrentTestDB 建立檔案型資料庫，讓多個連線能真正並行存取
+func setupConcurrentTestDB(t *testing.T) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), "concurrent.db") + "?_journal_mode=WAL&_busy_timeout=10000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.Discount{}, &models.DiscountReservation{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	return db
+}
+
 func TestCreateDiscount(t *testing.T) {
 	db := setupTestDB(t)
 	service := NewDiscountService(db)
@@ -38,7 +77,7 @@ func TestCreateDiscount(t *testing.T) {
 	discount := &models.Discount{
 		Name:      "Test Discount",
 		Type:      models.Percentage,
-		Value:     10.0,
+		Value:     dec("10"),
 		StartDate: time.Now(),
 		EndDate:   time.Now().Add(24 * time.Hour),
 		Priority:  1,
@@ -53,6 +92,76 @@ func TestCreateDiscount(t *testing.T) {
 	assert.Equal(t, int64(1), count)
 }
 
+func TestUpdateDiscountReplacesSettings(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	bogo := &models.Discount{
+		Name:           "Buy 1 Get 1",
+		Type:           models.BOGO,
+		StartDate:      now,
+		EndDate:        now.Add(24 * time.Hour),
+		BOGORule:       &models.BOGORule{Mode: models.BOGOSameItem, BuyQuantity: 1, GetQuantity: 1},
+		Conditions:     []models.DiscountCondition{{Type: models.CartTotal, Value: "100"}},
+		CurrencyValues: []models.DiscountCurrencyValue{{Currency: models.USD, MinCartTotal: dec("3")}},
+	}
+	assert.NoError(t, service.CreateDiscount(ctx, bogo))
+
+	// 取代規則與各貨幣金額，未提供的條件保留
+	update := &models.Discount{
+		Name:           "Buy 2 Get 1",
+		StartDate:      now,
+		EndDate:        now.Add(24 * time.Hour),
+		BOGORule:       &models.BOGORule{Mode: models.BOGOSameItem, BuyQuantity: 2, GetQuantity: 1},
+		CurrencyValues: []models.DiscountCurrencyValue{{Currency: models.USD, MinCartTotal: dec("5")}},
+	}
+	assert.NoError(t, service.UpdateDiscount(ctx, bogo.ID, update))
+	assert.Equal(t, "Buy 2 Get 1", update.Name)
+	assert.Equal(t, models.BOGO, update.Type)
+
+	saved, err := service.loadDiscount(db, bogo.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, saved.BOGORule.BuyQuantity)
+	assert.Len(t, saved.Conditions, 1)
+	assert.Len(t, saved.CurrencyValues, 1)
+	assert.Equal(t, dec("5"), saved.CurrencyValues[0].MinCartTotal)
+	var rules int64
+	db.Model(&models.BOGORule{}).Count(&rules)
+	assert.Equal(t, int64(1), rules)
+
+	volume := &models.Discount{
+		Name:      "Volume",
+		Type:      models.MultiItem,
+		StartDate: now,
+		EndDate:   now.Add(24 * time.Hour),
+		Tiers:     []models.DiscountTier{{MinQuantity: 2, Percent: dec("5")}},
+	}
+	assert.NoError(t, service.CreateDiscount(ctx, volume))
+
+	assert.NoError(t, service.UpdateDiscount(ctx, volume.ID, &models.Discount{
+		StartDate: now,
+		EndDate:   now.Add(24 * time.Hour),
+		Tiers: []models.DiscountTier{
+			{MinQuantity: 3, Percent: dec("10")},
+			{MinQuantity: 5, Percent: dec("20")},
+		},
+	}))
+	saved, err = service.loadDiscount(db, volume.ID)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Tiers, 2)
+	assert.Equal(t, 3, saved.Tiers[0].MinQuantity)
+	assert.Equal(t, dec("20"), saved.Tiers[1].Percent)
+
+	// 無效的設定不會寫入
+	err = service.UpdateDiscount(ctx, volume.ID, &models.Discount{Tiers: []models.DiscountTier{{MinQuantity: 0, Percent: dec("10")}}})
+	assert.ErrorIs(t, err, ErrInvalidDiscountTier)
+	saved, err = service.loadDiscount(db, volume.ID)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Tiers, 2)
+}
+
 func TestGetAvailableDiscounts(t *testing.T) {
 	db := setupTestDB(t)
 	service := NewDiscountService(db)
@@ -62,7 +171,7 @@ func TestGetAvailableDiscounts(t *testing.T) {
 		{
 			Name:      "High Priority Discount",
 			Type:      models.Percentage,
-			Value:     10.0,
+			Value:     dec("10"),
 			StartDate: time.Now(),
 			EndDate:   time.Now().Add(24 * time.Hour),
 			Priority:  1,
@@ -72,7 +181,7 @@ func TestGetAvailableDiscounts(t *testing.T) {
 		{
 			Name:      "Medium Priority Discount",
 			Type:      models.Fixed,
-			Value:     5.0,
+			Value:     dec("5"),
 			StartDate: time.Now(),
 			EndDate:   time.Now().Add(24 * time.Hour),
 			Priority:  2,
@@ -82,7 +191,7 @@ func TestGetAvailableDiscounts(t *testing.T) {
 		{
 			Name:      "Low Priority Discount",
 			Type:      models.Threshold,
-			Value:     20.0,
+			Value:     dec("20"),
 			StartDate: time.Now(),
 			EndDate:   time.Now().Add(24 * time.Hour),
 			Priority:  3,
@@ -103,7 +212,7 @@ func TestGetAvailableDiscounts(t *testing.T) {
 	}
 
 	// 測試獲取可用折扣
-	availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 150, []int64{})
+	availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("150"), []int64{})
 	assert.NoError(t, err)
 	assert.Len(t, availableDiscounts, 3)
 
@@ -136,7 +245,7 @@ func TestGetAvailableDiscounts(t *testing.T) {
 	assert.Equal(t, 50, mediumPriorityDiscount.UsageCount)
 
 	// 再次獲取可用折扣，此時高優先級和中等優先級折扣應已達使用上限
-	availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, 150, []int64{})
+	availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, dec("150"), []int64{})
 	assert.NoError(t, err)
 	assert.Len(t, availableDiscounts, 1) // 僅剩 Low Priority 折扣可用
 	assert.Equal(t, "Low Priority Discount", availableDiscounts[0].Name)
@@ -152,7 +261,7 @@ func TestUpdateDiscountUsage(t *testing.T) {
 	discount := &models.Discount{
 		Name:      "Usage Test Discount",
 		Type:      models.Percentage,
-		Value:     10.0,
+		Value:     dec("10"),
 		StartDate: now.Add(-1 * time.Hour), // 確保開始時間在當前時間之前
 		EndDate:   now.Add(24 * time.Hour), // 確保結束時間在當前時間之後
 		Priority:  1,
@@ -165,7 +274,7 @@ func TestUpdateDiscountUsage(t *testing.T) {
 	assert.NotZero(t, discount.ID)
 
 	// 使用可以確保小於等於比較成功的數字字串
-	cartTotal := 100.0
+	cartTotal := dec("100")
 	// 新增一個條件，確保條件值小於我們要測試的購物車總額
 	condition := &models.DiscountCondition{
 		DiscountID: discount.ID,
@@ -209,7 +318,7 @@ func TestUpdateDiscountUsage(t *testing.T) {
 		JOIN discount_conditions dc ON dc.discount_id = d.id
 		WHERE d.start_date <= ? AND d.end_date >= ?
 		AND dc.type = ? AND CAST(dc.value AS DECIMAL) <= ?
-	`, now, now, models.CartTotal, cartTotal).Scan(&matchingDiscounts).Error
+	`, now, now, models.CartTotal, cartTotal.Float64()).Scan(&matchingDiscounts).Error
 	assert.NoError(t, err)
 	t.Logf("Direct SQL found %d matching discounts", len(matchingDiscounts))
 
@@ -230,7 +339,7 @@ func TestUpdateDiscountUsage(t *testing.T) {
 	assert.Equal(t, 3, updatedDiscount.UsageCount)
 
 	// 確認折扣仍然可用
-	availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, 100.0, []int64{})
+	availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, dec("100"), []int64{})
 	assert.NoError(t, err)
 	assert.Len(t, availableDiscounts, 1, "Discount should still be available")
 
@@ -245,15 +354,108 @@ func TestUpdateDiscountUsage(t *testing.T) {
 	assert.Equal(t, 5, updatedDiscount.UsageCount)
 
 	// 驗證達到使用上限的折扣不再出現在可用折扣中
-	availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, 100.0, []int64{})
+	availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, dec("100"), []int64{})
 	assert.NoError(t, err)
 	assert.Len(t, availableDiscounts, 0, "No discounts should be available when usage limit is reached")
 }
 
+// 測試並行結帳時不會超過最大使用次數
+func TestUpdateDiscountUsageConcurrent(t *testing.T) {
+	db := setupConcurrentTestDB(t)
+	service := NewDiscountService(db)
+	now := time.Now()
+
+	discount := &models.Discount{
+		Name:      "Limited Discount",
+		Type:      models.Percentage,
+		Value:     dec("10"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		MaxUsage:  20,
+		// 模擬只剩少量名額時的搶購
+		UsageCount: 5,
+	}
+	assert.NoError(t, service.CreateDiscount(context.Background(), discount))
+
+	const workers = 60
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		exhausted int
+		failures  []error
+	)
+
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			err := service.UpdateDiscountUsage(context.Background(), []int64{discount.ID})
+
+			mu.Lock()
+			defer mu.Unlock()
+			var exhaustedErr *DiscountExhaustedError
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.As(err, &exhaustedErr):
+				assert.Equal(t, []int64{discount.ID}, exhaustedErr.DiscountIDs)
+				exhausted++
+			default:
+				failures = append(failures, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Empty(t, failures)
+	assert.Equal(t, 15, succeeded, "只剩 15 個名額")
+	assert.Equal(t, workers-15, exhausted)
+
+	var updated models.Discount
+	db.First(&updated, discount.ID)
+	assert.Equal(t, 20, updated.UsageCount)
+}
+
+// 測試部分折扣用完時整批回滾
+func TestUpdateDiscountUsageRollsBackBatch(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	now := time.Now()
+
+	available := &models.Discount{Name: "Available", Type: models.Fixed, Value: dec("5"), StartDate: now, EndDate: now.Add(time.Hour), MaxUsage: 10}
+	usedUp := &models.Discount{Name: "Used Up", Type: models.Fixed, Value: dec("5"), StartDate: now, EndDate: now.Add(time.Hour), MaxUsage: 1, UsageCount: 1}
+	unlimited := &models.Discount{Name: "Unlimited", Type: models.Fixed, Value: dec("5"), StartDate: now, EndDate: now.Add(time.Hour)}
+	for _, d := range []*models.Discount{available, usedUp, unlimited} {
+		assert.NoError(t, service.CreateDiscount(context.Background(), d))
+	}
+
+	exhaustedIDs, err := service.IncrementDiscountUsage(context.Background(), []int64{unlimited.ID, usedUp.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{usedUp.ID}, exhaustedIDs)
+
+	err = service.UpdateDiscountUsage(context.Background(), []int64{available.ID, usedUp.ID})
+	assert.ErrorIs(t, err, ErrDiscountUsageExceeded)
+
+	var exhaustedErr *DiscountExhaustedError
+	assert.True(t, errors.As(err, &exhaustedErr))
+	assert.Equal(t, []int64{usedUp.ID}, exhaustedErr.DiscountIDs)
+
+	// 可用的折扣也不應被遞增
+	var updated models.Discount
+	db.First(&updated, available.ID)
+	assert.Equal(t, 0, updated.UsageCount)
+}
+
 // 測試各種不同類型的折扣
 func TestDifferentDiscountTypes(t *testing.T) {
 	db := setupTestDB(t)
 	service := NewDiscountService(db)
+	engine := NewPricingEngine()
 	now := time.Now()
 
 	// 創建不同類型的折扣
@@ -262,7 +464,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 			// 1. 百分比折扣 (例如: 9折)
 			Name:      "Percentage Discount",
 			Type:      models.Percentage,
-			Value:     10.0, // 10% 折扣
+			Value:     dec("10"), // 10% 折扣
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  1,
@@ -272,7 +474,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 			// 2. 固定金額折扣 (例如: 減$50)
 			Name:      "Fixed Amount Discount",
 			Type:      models.Fixed,
-			Value:     50.0, // 減$50
+			Value:     dec("50"), // 減$50
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  2,
@@ -282,7 +484,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 			// 3. 滿額折扣 (例如: 滿$1000減$100)
 			Name:      "Threshold Discount",
 			Type:      models.Threshold,
-			Value:     100.0, // 減$100
+			Value:     dec("100"), // 減$100
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  3,
@@ -292,7 +494,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 			// 4. 買一送一
 			Name:      "Buy One Get One Free",
 			Type:      models.BOGO,
-			Value:     1.0, // 買1送1
+			Value:     dec("1"), // 買1送1
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  4,
@@ -302,7 +504,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 			// 5. 多件折扣 (例如: 第二件半價)
 			Name:      "Multi-Item Discount",
 			Type:      models.MultiItem,
-			Value:     50.0, // 第二件5折
+			Value:     dec("50"), // 第二件5折
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  5,
@@ -357,7 +559,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 	// 1. 測試百分比折扣
 	t.Run("Percentage Discount", func(t *testing.T) {
 		// 模擬購物車總額為 200
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 
 		// 找到百分比折扣
@@ -372,23 +574,18 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		assert.NotNil(t, percentageDiscount, "應該找到百分比折扣")
 		assert.Equal(t, models.Percentage, percentageDiscount.Type)
 
-		// 使用從API獲取的實際折扣值計算折扣金額
-		totalAmount := 200.0
-		var discountedAmount float64
+		// 使用計價引擎計算折扣後金額
+		lines := []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}}
+		discountedAmount := engine.Calculate(lines, []models.Discount{*percentageDiscount}).Total
 
-		// 根據折扣類型計算實際折扣金額
-		if percentageDiscount.Type == models.Percentage {
-			discountedAmount = totalAmount * (1 - percentageDiscount.Value/100)
-		}
-
-		expectedDiscountedAmount := 200.0 * (1 - 10.0/100) // 200 * 0.9 = 180
+		expectedDiscountedAmount := dec("180") // 200 * 0.9 = 180
 		assert.Equal(t, expectedDiscountedAmount, discountedAmount)
 	})
 
 	// 2. 測試固定金額折扣
 	t.Run("Fixed Amount Discount", func(t *testing.T) {
 		// 模擬購物車總額為 200
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 
 		// 找到固定金額折扣
@@ -403,22 +600,17 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		assert.NotNil(t, fixedDiscount, "應該找到固定金額折扣")
 		assert.Equal(t, models.Fixed, fixedDiscount.Type)
 
-		// 使用從API獲取的實際折扣值計算折扣金額
-		totalAmount := 200.0
-		var discountedAmount float64
-
-		// 根據折扣類型計算實際折扣金額
-		if fixedDiscount.Type == models.Fixed {
-			discountedAmount = totalAmount - fixedDiscount.Value
-		}
+		// 使用計價引擎計算折扣後金額
+		lines := []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}}
+		discountedAmount := engine.Calculate(lines, []models.Discount{*fixedDiscount}).Total
 
-		assert.Equal(t, 150.0, discountedAmount)
+		assert.Equal(t, dec("150"), discountedAmount)
 	})
 
 	// 3. 測試滿額折扣
 	t.Run("Threshold Discount", func(t *testing.T) {
 		// 購物車總額未達到門檻
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 500, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("500"), []int64{})
 		assert.NoError(t, err)
 
 		// 檢查未達門檻時是否找不到滿額折扣
@@ -432,7 +624,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		assert.False(t, thresholdFound, "未達到門檻時不應該找到滿額折扣")
 
 		// 購物車總額達到門檻
-		availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, 1200, []int64{})
+		availableDiscounts, err = service.GetAvailableDiscounts(context.Background(), 0, dec("1200"), []int64{})
 		assert.NoError(t, err)
 
 		// 找到滿額折扣
@@ -447,24 +639,28 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		assert.NotNil(t, thresholdDiscount, "達到門檻時應該找到滿額折扣")
 		assert.Equal(t, models.Threshold, thresholdDiscount.Type)
 
-		// 使用從API獲取的實際折扣值計算折扣金額
-		totalAmount := 1200.0
-		var discountedAmount float64
+		// 使用計價引擎計算折扣後金額
+		lines := []CartLine{{ProductID: 1, UnitPrice: dec("1200"), Quantity: 1}}
+		discountedAmount := engine.Calculate(lines, []models.Discount{*thresholdDiscount}).Total
 
-		// 根據折扣類型計算實際折扣金額
-		if thresholdDiscount.Type == models.Threshold {
-			discountedAmount = totalAmount - thresholdDiscount.Value
-		}
-
-		assert.Equal(t, 1100.0, discountedAmount)
+		assert.Equal(t, dec("1100"), discountedAmount)
 	})
 
 	// 4. 測試買一送一
 	t.Run("Buy One Get One Free", func(t *testing.T) {
 		productID := int64(4) // 與之前設定匹配的商品ID
 
-		// 使用商品ID查詢折扣
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 0, []int64{productID})
+		// 只買一件時未達最低購買數量
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("0"), []int64{productID})
+		assert.NoError(t, err)
+		for _, d := range availableDiscounts {
+			assert.NotEqual(t, "Buy One Get One Free", d.Name, "未達最低購買數量時不應該找到買一送一折扣")
+		}
+
+		// 使用購物車明細 (含數量) 查詢折扣
+		availableDiscounts, err = service.FindAvailableDiscounts(context.Background(), DiscountQuery{
+			Lines: []CartLine{{ProductID: productID, UnitPrice: dec("100"), Quantity: 4}},
+		})
 		assert.NoError(t, err)
 
 		// 找到買一送一折扣
@@ -479,28 +675,22 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		assert.NotNil(t, bogoDiscount, "應該找到買一送一折扣")
 		assert.Equal(t, models.BOGO, bogoDiscount.Type)
 
-		// 模擬購買計算的邏輯，使用折扣物件中的值
-		quantity := 4
-		unitPrice := 100.0
-		regularPrice := float64(quantity) * unitPrice
-
-		// 實際根據折扣規則計算折扣價格
-		var discountedPrice float64
-		if bogoDiscount.Type == models.BOGO && bogoDiscount.Value == 1.0 {
-			// 買N送N的邏輯 (這裡是買1送1)
-			discountedPrice = float64(quantity/2+quantity%2) * unitPrice
-		}
+		// 使用計價引擎計算買一送一後的價格 (4件商品，每件100)
+		lines := []CartLine{{ProductID: productID, UnitPrice: dec("100"), Quantity: 4}}
+		result := engine.Calculate(lines, []models.Discount{*bogoDiscount})
 
-		assert.Equal(t, 400.0, regularPrice)
-		assert.Equal(t, 200.0, discountedPrice)
+		assert.Equal(t, dec("400"), result.Subtotal)
+		assert.Equal(t, dec("200"), result.Total)
 	})
 
 	// 5. 測試多件折扣
 	t.Run("Multi-Item Discount", func(t *testing.T) {
 		productID := int64(5) // 與之前設定匹配的商品ID
 
-		// 使用商品ID查詢折扣
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 0, []int64{productID})
+		// 使用購物車明細 (含數量) 查詢折扣
+		availableDiscounts, err := service.FindAvailableDiscounts(context.Background(), DiscountQuery{
+			Lines: []CartLine{{ProductID: productID, UnitPrice: dec("100"), Quantity: 3}},
+		})
 		assert.NoError(t, err)
 
 		// 找到多件折扣
@@ -515,35 +705,12 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		assert.NotNil(t, multiItemDiscount, "應該找到多件折扣")
 		assert.Equal(t, models.MultiItem, multiItemDiscount.Type)
 
-		// 模擬購買計算的邏輯，使用折扣物件中的值
-		quantity := 3
-		unitPrice := 100.0
-		regularPrice := float64(quantity) * unitPrice
-
-		// 實際根據折扣規則計算折扣價格
-		var discountedPrice float64
-		if multiItemDiscount.Type == models.MultiItem {
-			// 第二件特定折扣的邏輯 (這裡是第二件5折)
-			discountFactor := multiItemDiscount.Value / 100.0
-
-			// 計算每一件商品應用的價格
-			prices := make([]float64, quantity)
-			for i := 0; i < quantity; i++ {
-				if (i+1)%2 == 0 { // 第二件、第四件...
-					prices[i] = unitPrice * discountFactor
-				} else {
-					prices[i] = unitPrice
-				}
-			}
-
-			// 累加所有商品價格
-			for _, price := range prices {
-				discountedPrice += price
-			}
-		}
+		// 使用計價引擎計算第二件5折後的價格 (3件商品，每件100)
+		lines := []CartLine{{ProductID: productID, UnitPrice: dec("100"), Quantity: 3}}
+		result := engine.Calculate(lines, []models.Discount{*multiItemDiscount})
 
-		assert.Equal(t, 300.0, regularPrice)
-		assert.Equal(t, 250.0, discountedPrice)
+		assert.Equal(t, dec("300"), result.Subtotal)
+		assert.Equal(t, dec("250"), result.Total)
 	})
 
 	// 測試折扣的使用次數限制
@@ -559,7 +726,7 @@ func TestDifferentDiscountTypes(t *testing.T) {
 		}
 
 		// 再次獲取折扣，應該不會找到此折扣
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 
 		found := false
@@ -573,35 +740,6 @@ func TestDifferentDiscountTypes(t *testing.T) {
 	})
 }
 
-// 新增一個輔助方法，用於計算應用折扣後的金額
-func calculateDiscountedAmount(discount *models.Discount, amount float64, quantity int, unitPrice float64) float64 {
-	switch discount.Type {
-	case models.Percentage:
-		return amount * (1 - discount.Value/100)
-	case models.Fixed:
-		return amount - discount.Value
-	case models.Threshold:
-		return amount - discount.Value
-	case models.BOGO:
-		// 買N送N的邏輯
-		return float64(quantity/2+quantity%2) * unitPrice
-	case models.MultiItem:
-		// 第二件特定折扣
-		discountFactor := discount.Value / 100.0
-		var total float64
-		for i := 0; i < quantity; i++ {
-			if (i+1)%2 == 0 { // 第二件
-				total += unitPrice * discountFactor
-			} else {
-				total += unitPrice
-			}
-		}
-		return total
-	default:
-		return amount
-	}
-}
-
 // 測試折扣優先權機制
 func TestDiscountPriority(t *testing.T) {
 	db := setupTestDB(t)
@@ -613,7 +751,7 @@ func TestDiscountPriority(t *testing.T) {
 		{
 			Name:      "Low Priority Discount",
 			Type:      models.Percentage,
-			Value:     5.0, // 5% 折扣
+			Value:     dec("5"), // 5% 折扣
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  models.PriorityLow, // 優先級低
@@ -623,7 +761,7 @@ func TestDiscountPriority(t *testing.T) {
 		{
 			Name:      "Medium Priority Discount",
 			Type:      models.Percentage,
-			Value:     10.0, // 10% 折扣
+			Value:     dec("10"), // 10% 折扣
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  models.PriorityMedium, // 優先級中
@@ -633,7 +771,7 @@ func TestDiscountPriority(t *testing.T) {
 		{
 			Name:      "High Priority Discount",
 			Type:      models.Percentage,
-			Value:     15.0, // 15% 折扣
+			Value:     dec("15"), // 15% 折扣
 			StartDate: now.Add(-1 * time.Hour),
 			EndDate:   now.Add(24 * time.Hour),
 			Priority:  models.PriorityHigh, // 優先級高
@@ -659,7 +797,7 @@ func TestDiscountPriority(t *testing.T) {
 	// 1. 測試基本優先級排序 (低數字優先級高)
 	t.Run("Basic Priority Ordering", func(t *testing.T) {
 		// 獲取可用折扣，應該按優先級排序
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 		assert.Len(t, availableDiscounts, 3, "應該找到所有三個折扣")
 
@@ -676,7 +814,7 @@ func TestDiscountPriority(t *testing.T) {
 			{
 				Name:      "Non-Stackable Discount",
 				Type:      models.Percentage,
-				Value:     8.0,
+				Value:     dec("8"),
 				StartDate: now.Add(-1 * time.Hour),
 				EndDate:   now.Add(24 * time.Hour),
 				Priority:  models.PriorityMedium,
@@ -686,7 +824,7 @@ func TestDiscountPriority(t *testing.T) {
 			{
 				Name:      "Stackable Discount",
 				Type:      models.Percentage,
-				Value:     8.0,
+				Value:     dec("8"),
 				StartDate: now.Add(-1 * time.Hour),
 				EndDate:   now.Add(24 * time.Hour),
 				Priority:  models.PriorityMedium,
@@ -708,7 +846,7 @@ func TestDiscountPriority(t *testing.T) {
 		}
 
 		// 獲取可用折扣，檢查排序
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 
 		// 找出兩個相同優先級的折扣的排序
@@ -729,7 +867,7 @@ func TestDiscountPriority(t *testing.T) {
 	// 3. 測試有多個同類型折扣時的應用邏輯
 	t.Run("Multiple Applicable Discounts", func(t *testing.T) {
 		// 只測試第一個（最高優先級）折扣實際計算的金額
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 		assert.True(t, len(availableDiscounts) > 0, "應該至少找到一個折扣")
 
@@ -737,20 +875,18 @@ func TestDiscountPriority(t *testing.T) {
 		highestPriorityDiscount := availableDiscounts[0]
 		assert.Equal(t, "High Priority Discount", highestPriorityDiscount.Name)
 		assert.Equal(t, models.Percentage, highestPriorityDiscount.Type)
-		assert.Equal(t, 15.0, highestPriorityDiscount.Value)
-
-		// 使用最高優先級折扣計算折扣金額
-		totalAmount := 200.0
+		assert.Equal(t, dec("15"), highestPriorityDiscount.Value)
 
-		// 使用輔助函數計算折扣金額
-		discountedAmount := calculateDiscountedAmount(&highestPriorityDiscount, totalAmount, 0, 0)
+		// 使用計價引擎計算最高優先級折扣後的金額
+		lines := []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}}
+		discountedAmount := NewPricingEngine().Calculate(lines, []models.Discount{highestPriorityDiscount}).Total
 
 		// 驗證使用了最高優先級的折扣 (15%)
-		expectedAmount := 200.0 * (1 - 15.0/100) // 200 * 0.85 = 170
+		expectedAmount := dec("170") // 200 * 0.85 = 170
 		assert.Equal(t, expectedAmount, discountedAmount)
 
 		// 如果應用了次高優先級折扣 (10%) 會是什麼結果
-		mediumPriorityAmount := 200.0 * (1 - 10.0/100) // 200 * 0.9 = 180
+		mediumPriorityAmount := dec("180") // 200 * 0.9 = 180
 		// 確認實際折扣金額不等於使用次高優先級計算的結果
 		assert.NotEqual(t, mediumPriorityAmount, discountedAmount)
 	})
@@ -766,7 +902,7 @@ func TestDiscountPriority(t *testing.T) {
 			{
 				Name:      "Stackable Discount 1",
 				Type:      models.Percentage,
-				Value:     10.0, // 10% 折扣
+				Value:     dec("10"), // 10% 折扣
 				StartDate: now.Add(-1 * time.Hour),
 				EndDate:   now.Add(24 * time.Hour),
 				Priority:  models.PriorityHigh,
@@ -776,7 +912,7 @@ func TestDiscountPriority(t *testing.T) {
 			{
 				Name:      "Stackable Discount 2",
 				Type:      models.Fixed,
-				Value:     20.0, // 固定減$20
+				Value:     dec("20"), // 固定減$20
 				StartDate: now.Add(-1 * time.Hour),
 				EndDate:   now.Add(24 * time.Hour),
 				Priority:  models.PriorityMedium,
@@ -786,7 +922,7 @@ func TestDiscountPriority(t *testing.T) {
 			{
 				Name:      "Non-Stackable Discount",
 				Type:      models.Percentage,
-				Value:     15.0, // 15% 折扣
+				Value:     dec("15"), // 15% 折扣
 				StartDate: now.Add(-1 * time.Hour),
 				EndDate:   now.Add(24 * time.Hour),
 				Priority:  models.PriorityLow,
@@ -808,13 +944,10 @@ func TestDiscountPriority(t *testing.T) {
 		}
 
 		// 獲取可用折扣
-		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, 200, []int64{})
+		availableDiscounts, err := service.GetAvailableDiscounts(context.Background(), 0, dec("200"), []int64{})
 		assert.NoError(t, err)
 		assert.Len(t, availableDiscounts, 3, "應該找到所有三個折扣")
 
-		// 模擬購物車總金額
-		totalAmount := 200.0
-
 		// 模擬結帳流程中的折扣計算邏輯
 		// 1. 先應用不可疊加的折扣 (找到優先級最高的)
 		// 2. 再應用所有可疊加的折扣
@@ -829,41 +962,190 @@ func TestDiscountPriority(t *testing.T) {
 			}
 		}
 
-		// 應用不可疊加的折扣
-		var finalAmount float64
+		applied := make([]models.Discount, 0, len(availableDiscounts))
 		if highestNonStackable != nil {
-			finalAmount = calculateDiscountedAmount(highestNonStackable, totalAmount, 0, 0)
-		} else {
-			finalAmount = totalAmount
+			applied = append(applied, *highestNonStackable)
 		}
 
-		// 應用可疊加的折扣 (按優先級排序)
-		var stackableDiscountsList []*models.Discount
+		// 可疊加的折扣按優先級排序後依序套用
+		var stackableDiscountsList []models.Discount
 		for i := range availableDiscounts {
 			if availableDiscounts[i].Stackable {
-				stackableDiscountsList = append(stackableDiscountsList, &availableDiscounts[i])
+				stackableDiscountsList = append(stackableDiscountsList, availableDiscounts[i])
 			}
 		}
-
-		// 按優先級排序
 		sort.Slice(stackableDiscountsList, func(i, j int) bool {
 			return stackableDiscountsList[i].Priority < stackableDiscountsList[j].Priority
 		})
+		applied = append(applied, stackableDiscountsList...)
 
-		// 應用可疊加折扣
-		for _, discount := range stackableDiscountsList {
-			finalAmount = calculateDiscountedAmount(discount, finalAmount, 0, 0)
-		}
+		// 模擬購物車總金額 200
+		lines := []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}}
+		finalAmount := NewPricingEngine().Calculate(lines, applied).Total
 
 		// 驗證最終金額
 		// 預期計算過程：
 		// 1. 應用非疊加折扣: 200 * (1 - 15/100) = 170
 		// 2. 應用第一個可疊加折扣: 170 * (1 - 10/100) = 153
 		// 3. 應用第二個可疊加折扣: 153 - 20 = 133
-		expectedFinalAmount := 200.0 * (1 - 15.0/100)              // 應用 15% 折扣 => 170
-		expectedFinalAmount = expectedFinalAmount * (1 - 10.0/100) // 應用 10% 折扣 => 153
-		expectedFinalAmount = expectedFinalAmount - 20.0           // 應用固定折扣 $20 => 133
+		expectedFinalAmount := dec("200").Sub(dec("200").Percent(dec("15"), models.RoundHalfUp))                  // 應用 15% 折扣 => 170
+		expectedFinalAmount = expectedFinalAmount.Sub(expectedFinalAmount.Percent(dec("10"), models.RoundHalfUp)) // 應用 10% 折扣 => 153
+		expectedFinalAmount = expectedFinalAmount.Sub(dec("20"))                                                  // 應用固定折扣 $20 => 133
 
-		assert.InDelta(t, expectedFinalAmount, finalAmount, 0.01, "折扣計算結果不正確")
+		assert.Equal(t, expectedFinalAmount, finalAmount, "折扣計算結果不正確")
 	})
 }
+
+// 測試多個條件的 AND 語意：所有條件都必須通過，沒有條件的折扣無條件適用
+func TestGetAvailableDiscountsConditionSets(t *testing.T) {
+	db := setupTestDB(t)
+	provider := StaticMembershipProvider{1: models.MembershipGold, 2: models.MembershipSilver}
+	service := NewDiscountService(db).WithMembershipProvider(provider)
+	now := time.Now()
+
+	conditionSets := map[string][]models.DiscountCondition{
+		"Unconditional": nil,
+		"Total Only": {
+			{Type: models.CartTotal, Value: "100"},
+		},
+		"Gold Only": {
+			{Type: models.MembershipLevel, Value: "GOLD"},
+		},
+		"Gold And Total": {
+			{Type: models.MembershipLevel, Value: "GOLD"},
+			{Type: models.CartTotal, Value: "500"},
+		},
+		"Shoes x2 Over 300": {
+			{Type: models.ProductCategory, Value: "Shoes"},
+			{Type: models.MinQuantity, Value: "2"},
+			{Type: models.CartTotal, Value: "300"},
+		},
+	}
+	for name, conditions := range conditionSets {
+		discount := &models.Discount{
+			Name:       name,
+			Type:       models.Percentage,
+			Value:      dec("5"),
+			StartDate:  now.Add(-1 * time.Hour),
+			EndDate:    now.Add(24 * time.Hour),
+			Conditions: conditions,
+		}
+		assert.NoError(t, service.CreateDiscount(context.Background(), discount))
+	}
+
+	shoes := func(quantity int) []CartLine {
+		return []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: quantity, Category: "Shoes"}}
+	}
+
+	tests := []struct {
+		name      string
+		userID    int64
+		cartTotal models.Decimal
+		lines     []CartLine
+		expected  []string
+	}{
+		{
+			name:     "訪客空購物車只有無條件折扣",
+			expected: []string{"Unconditional"},
+		},
+		{
+			name:      "訪客達到總額",
+			cartTotal: dec("150"),
+			expected:  []string{"Unconditional", "Total Only"},
+		},
+		{
+			name:      "金卡會員同時提供總額",
+			userID:    1,
+			cartTotal: dec("150"),
+			expected:  []string{"Unconditional", "Total Only", "Gold Only"},
+		},
+		{
+			name:      "金卡會員總額達到所有門檻",
+			userID:    1,
+			cartTotal: dec("600"),
+			expected:  []string{"Unconditional", "Total Only", "Gold Only", "Gold And Total"},
+		},
+		{
+			name:      "銀卡會員總額達標但等級不足",
+			userID:    2,
+			cartTotal: dec("600"),
+			expected:  []string{"Unconditional", "Total Only"},
+		},
+		{
+			name:     "鞋類兩件且總額由明細計算",
+			lines:    shoes(2),
+			expected: []string{"Unconditional", "Total Only", "Shoes x2 Over 300"},
+		},
+		{
+			name:     "鞋類一件未達數量",
+			lines:    shoes(1),
+			expected: []string{"Unconditional", "Total Only"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discounts, err := service.FindAvailableDiscounts(context.Background(), DiscountQuery{
+				UserID:    tt.userID,
+				CartTotal: tt.cartTotal,
+				Lines:     tt.lines,
+			})
+			assert.NoError(t, err)
+
+			names := make([]string, 0, len(discounts))
+			for _, d := range discounts {
+				names = append(names, d.Name)
+			}
+			assert.ElementsMatch(t, tt.expected, names)
+		})
+	}
+}
+
+func TestFindCartDiscounts(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db).WithMembershipProvider(StaticMembershipProvider{1: models.MembershipGold})
+	carts := NewCartService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, discount := range []*models.Discount{
+		{Name: "Spend 5000", Type: models.Threshold, Value: dec("500"), Conditions: []models.DiscountCondition{{Type: models.CartTotal, Value: "5000"}}},
+		{Name: "Gold Only", Type: models.Percentage, Value: dec("5"), Conditions: []models.DiscountCondition{{Type: models.MembershipLevel, Value: "GOLD"}}},
+	} {
+		discount.StartDate = now.Add(-1 * time.Hour)
+		discount.EndDate = now.Add(24 * time.Hour)
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+	}
+
+	cart, err := carts.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	cart, err = carts.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("1000"), Quantity: 2})
+	assert.NoError(t, err)
+
+	// 總額以購物車明細計算 (2000)，未達門檻；會員等級以購物車的用戶為準
+	discounts, err := service.FindCartDiscounts(ctx, cart)
+	assert.NoError(t, err)
+	assert.Len(t, discounts, 1)
+	assert.Equal(t, "Gold Only", discounts[0].Name)
+
+	cart, err = carts.UpdateItemQuantity(ctx, cart.ID, 1, 5)
+	assert.NoError(t, err)
+	discounts, err = service.FindCartDiscounts(ctx, cart)
+	assert.NoError(t, err)
+	assert.Len(t, discounts, 2)
+
+	// 正式環境不接受呼叫端提供的總額
+	strict := service.WithClientTotals(false)
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 1}}
+	_, err = strict.FindAvailableDiscounts(ctx, DiscountQuery{UserID: 1, CartTotal: dec("5000"), Lines: lines})
+	assert.ErrorIs(t, err, ErrClientTotalRejected)
+	_, err = strict.ApplyDiscounts(ctx, ApplyDiscountInput{CartID: cart.ID, UserID: 1, CartTotal: dec("5000"), Lines: lines})
+	assert.ErrorIs(t, err, ErrClientTotalRejected)
+
+	discounts, err = strict.FindAvailableDiscounts(ctx, DiscountQuery{UserID: 1, Lines: lines})
+	assert.NoError(t, err)
+	assert.Len(t, discounts, 1)
+	discounts, err = strict.FindCartDiscounts(ctx, cart)
+	assert.NoError(t, err)
+	assert.Len(t, discounts, 2)
+}
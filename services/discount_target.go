@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"shopping_cart/models"
+)
+
+var ErrInvalidDiscountTarget = errors.New("invalid discount target")
+
+// targetRules 是折扣的適用範圍：有包含規則時商品至少要符合一條，且不可符合任何排除規則
+type targetRules struct {
+	includeProducts map[int64]bool
+	excludeProducts map[int64]bool
+	includes        []models.DiscountTarget
+	excludes        []models.DiscountTarget
+}
+
+// newTargetRules 由折扣的商品與適用範圍建立規則，贈品不算在內
+func newTargetRules(discount *models.Discount) targetRules {
+	rules := targetRules{
+		includeProducts: make(map[int64]bool, len(discount.Products)),
+		excludeProducts: make(map[int64]bool),
+	}
+	for _, p := range discount.Products {
+		switch {
+		case p.Gift:
+		case p.Exclude:
+			rules.excludeProducts[p.ProductID] = true
+		default:
+			rules.includeProducts[p.ProductID] = true
+		}
+	}
+	for _, target := range discount.Targets {
+		if target.Exclude {
+			rules.excludes = append(rules.excludes, target)
+		} else {
+			rules.includes = append(rules.includes, target)
+		}
+	}
+	return rules
+}
+
+// restricted 回傳是否限定了適用範圍 (包含或排除)
+func (r targetRules) restricted() bool {
+	return len(r.includeProducts) > 0 || len(r.excludeProducts) > 0 || len(r.includes) > 0 || len(r.excludes) > 0
+}
+
+// matches 判斷商品是否在適用範圍內
+func (r targetRules) matches(productID int64, category, brand string, tags []string) bool {
+	if r.excludeProducts[productID] {
+		return false
+	}
+	for _, target := range r.excludes {
+		if targetMatches(target, category, brand, tags) {
+			return false
+		}
+	}
+
+	if len(r.includeProducts) == 0 && len(r.includes) == 0 {
+		return true
+	}
+	if r.includeProducts[productID] {
+		return true
+	}
+	for _, target := range r.includes {
+		if targetMatches(target, category, brand, tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r targetRules) matchesLine(line CartLine) bool {
+	return r.matches(line.ProductID, line.Category, line.Brand, line.Tags)
+}
+
+func targetMatches(target models.DiscountTarget, category, brand string, tags []string) bool {
+	switch target.Type {
+	case models.TargetCategory:
+		return categoryMatches(category, target.Value)
+	case models.TargetBrand:
+		return strings.EqualFold(strings.TrimSpace(brand), strings.TrimSpace(target.Value))
+	case models.TargetTag:
+		for _, tag := range tags {
+			if strings.EqualFold(strings.TrimSpace(tag), strings.TrimSpace(target.Value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateDiscountTargets 檢查適用範圍的設定
+func validateDiscountTargets(discount *models.Discount) error {
+	for _, p := range discount.Products {
+		if p.Gift && p.Exclude {
+			return fmt.Errorf("%w: product %d cannot be both a gift and excluded", ErrInvalidDiscountTarget, p.ProductID)
+		}
+	}
+	for _, target := range discount.Targets {
+		switch target.Type {
+		case models.TargetCategory, models.TargetBrand, models.TargetTag:
+		default:
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidDiscountTarget, target.Type)
+		}
+		if strings.TrimSpace(target.Value) == "" {
+			return fmt.Errorf("%w: %s value is required", ErrInvalidDiscountTarget, target.Type)
+		}
+	}
+	return nil
+}
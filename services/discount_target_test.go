@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscountTargeting(t *testing.T) {
+	engine := NewPricingEngine()
+
+	lines := []CartLine{
+		{ProductID: 1, UnitPrice: dec("1000"), Quantity: 1, Category: "Shoes", Brand: "Acme"},
+		{ProductID: 2, UnitPrice: dec("2000"), Quantity: 1, Category: "shoes", Brand: "Zoom", Tags: []string{"new-arrival"}},
+		{ProductID: 3, UnitPrice: dec("500"), Quantity: 1, Category: "Socks", Brand: "Acme"},
+		{ProductID: 4, UnitPrice: dec("800"), Quantity: 1, Category: "Shoes", Brand: "Acme", Tags: []string{"clearance"}},
+	}
+
+	tests := []struct {
+		name     string
+		products []models.DiscountProduct
+		targets  []models.DiscountTarget
+		discount []models.Decimal // 每筆明細的折抵金額
+	}{
+		{
+			name: "鞋類八折但新品除外",
+			targets: []models.DiscountTarget{
+				{Type: models.TargetCategory, Value: "SHOES"},
+				{Type: models.TargetTag, Value: "New-Arrival", Exclude: true},
+			},
+			discount: []models.Decimal{dec("200"), dec("0"), dec("0"), dec("160")},
+		},
+		{
+			name:     "全館八折排除指定商品",
+			products: []models.DiscountProduct{{ProductID: 4, Exclude: true}},
+			discount: []models.Decimal{dec("200"), dec("400"), dec("100"), dec("0")},
+		},
+		{
+			name:     "指定品牌",
+			targets:  []models.DiscountTarget{{Type: models.TargetBrand, Value: "acme"}},
+			products: []models.DiscountProduct{{ProductID: 3, Exclude: true}},
+			discount: []models.Decimal{dec("200"), dec("0"), dec("0"), dec("160")},
+		},
+		{
+			name:     "指定商品或類別任一符合",
+			products: []models.DiscountProduct{{ProductID: 2}},
+			targets:  []models.DiscountTarget{{Type: models.TargetCategory, Value: "Socks"}},
+			discount: []models.Decimal{dec("0"), dec("400"), dec("100"), dec("0")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount := models.Discount{ID: 1, Type: models.Percentage, Value: dec("20"), Products: tt.products, Targets: tt.targets}
+			result := engine.Calculate(lines, []models.Discount{discount})
+
+			amounts := make([]models.Decimal, 0, len(result.Lines))
+			for _, line := range result.Lines {
+				amounts = append(amounts, line.DiscountTotal)
+			}
+			assert.Equal(t, tt.discount, amounts)
+		})
+	}
+}
+
+func TestApplyDiscountsWithTargets(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	shoes := &models.Discount{
+		Name:      "20% Off Shoes",
+		Type:      models.Percentage,
+		Value:     dec("20"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		Targets: []models.DiscountTarget{
+			{Type: models.TargetCategory, Value: "Shoes"},
+			{Type: models.TargetTag, Value: "new-arrival", Exclude: true},
+		},
+	}
+	assert.NoError(t, service.CreateDiscount(ctx, shoes))
+
+	// 無效的適用範圍
+	assert.ErrorIs(t, service.CreateDiscount(ctx, &models.Discount{Name: "Invalid", Targets: []models.DiscountTarget{{Type: "COLOR", Value: "red"}}}), ErrInvalidDiscountTarget)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, &models.Discount{Name: "Invalid", Targets: []models.DiscountTarget{{Type: models.TargetBrand}}}), ErrInvalidDiscountTarget)
+
+	// 只有新品時沒有適用的商品
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("1000"), Quantity: 1, Category: "Shoes", Tags: []string{"new-arrival"}}}
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+	assert.Empty(t, application.Applied)
+	assert.Len(t, application.Rejected, 1)
+	assert.Equal(t, reasonNoEligibleProducts, application.Rejected[0].Reason)
+
+	// 購物車的品牌與標籤會帶入計價
+	carts := NewCartService(db)
+	cart, err := carts.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	_, err = carts.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("1000"), Quantity: 1, Category: "Shoes", Tags: []string{"new-arrival"}})
+	assert.NoError(t, err)
+	cart, err = carts.AddItem(ctx, cart.ID, CartItemInput{ProductID: 2, UnitPrice: dec("500"), Quantity: 2, Category: "Shoes", Brand: "Acme", Tags: []string{" sale ", ""}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sale"}, cart.Items[1].TagList())
+
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: CartLines(cart)})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, dec("200"), application.DiscountTotal)
+	assert.Equal(t, dec("1800"), application.Total)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"shopping_cart/models"
+)
+
+var ErrInvalidDiscountTier = errors.New("invalid discount tier")
+
+// validateDiscountTiers 檢查階梯級距：MULTI_ITEM 以件數、THRESHOLD 以消費金額為門檻，門檻不可重複
+func validateDiscountTiers(discount *models.Discount) error {
+	if len(discount.Tiers) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(discount.Tiers))
+	for _, tier := range discount.Tiers {
+		var key string
+		switch discount.Type {
+		case models.MultiItem:
+			if tier.MinQuantity <= 0 {
+				return fmt.Errorf("%w: min quantity must be positive", ErrInvalidDiscountTier)
+			}
+			if !tier.Percent.IsPositive() || tier.Percent.GreaterThan(models.NewDecimal(100)) {
+				return fmt.Errorf("%w: percent must be between 0 and 100", ErrInvalidDiscountTier)
+			}
+			key = fmt.Sprint(tier.MinQuantity)
+		case models.Threshold:
+			if !tier.MinSpend.IsPositive() {
+				return fmt.Errorf("%w: min spend must be positive", ErrInvalidDiscountTier)
+			}
+			if !tier.Amount.IsPositive() {
+				return fmt.Errorf("%w: amount must be positive", ErrInvalidDiscountTier)
+			}
+			key = tier.MinSpend.String()
+		default:
+			return fmt.Errorf("%w: tiers are not supported for %s discounts", ErrInvalidDiscountTier, discount.Type)
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate threshold %s", ErrInvalidDiscountTier, key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// quantityTier 回傳件數達到的最高級距，未達任何級距時回傳 nil
+func quantityTier(tiers []models.DiscountTier, quantity int) *models.DiscountTier {
+	var reached *models.DiscountTier
+	for i := range tiers {
+		if quantity >= tiers[i].MinQuantity && (reached == nil || tiers[i].MinQuantity > reached.MinQuantity) {
+			reached = &tiers[i]
+		}
+	}
+	return reached
+}
+
+// spendTier 回傳消費金額達到的最高級距，未達任何級距時回傳 nil
+func spendTier(tiers []models.DiscountTier, spend models.Decimal) *models.DiscountTier {
+	var reached *models.DiscountTier
+	for i := range tiers {
+		if !spend.LessThan(tiers[i].MinSpend) && (reached == nil || tiers[i].MinSpend.GreaterThan(reached.MinSpend)) {
+			reached = &tiers[i]
+		}
+	}
+	return reached
+}
+
+// tieredAmounts 依階梯級距計算各明細的折抵金額
+// 數量與消費金額以所有適用明細合計，並以折扣前的小計判斷
+func (e *PricingEngine) tieredAmounts(lines []LineBreakdown, eligible []int, discount *models.Discount, amounts map[int]models.Decimal) {
+	switch discount.Type {
+	case models.MultiItem:
+		quantity := 0
+		for _, idx := range eligible {
+			quantity += lines[idx].Quantity
+		}
+		tier := quantityTier(discount.Tiers, quantity)
+		if tier == nil {
+			return
+		}
+		for _, idx := range eligible {
+			amounts[idx] = lines[idx].Total.Percent(tier.Percent, e.rounding)
+		}
+
+	case models.Threshold:
+		var spend models.Decimal
+		for _, idx := range eligible {
+			spend = spend.Add(lines[idx].Subtotal)
+		}
+		tier := spendTier(discount.Tiers, spend)
+		if tier == nil {
+			return
+		}
+		e.allocateProportionally(lines, eligible, tier.Amount, amounts)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTieredDiscounts(t *testing.T) {
+	engine := NewPricingEngine()
+
+	volume := models.Discount{ID: 1, Type: models.MultiItem, Tiers: []models.DiscountTier{
+		{MinQuantity: 10, Percent: dec("20")},
+		{MinQuantity: 5, Percent: dec("10")},
+	}}
+	spend := models.Discount{ID: 2, Type: models.Threshold, Tiers: []models.DiscountTier{
+		{MinSpend: dec("1000"), Amount: dec("100")},
+		{MinSpend: dec("2000"), Amount: dec("250")},
+	}}
+
+	tests := []struct {
+		name     string
+		lines    []CartLine
+		discount models.Discount
+		amount   models.Decimal // 預期折抵金額
+	}{
+		{name: "1-4件原價", lines: []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 4}}, discount: volume, amount: dec("0")},
+		{name: "5-9件9折", lines: []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 5}}, discount: volume, amount: dec("50")},
+		{name: "10件以上8折", lines: []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 12}}, discount: volume, amount: dec("240")},
+		{
+			name: "件數以所有適用商品合計",
+			lines: []CartLine{
+				{ProductID: 1, UnitPrice: dec("100"), Quantity: 3},
+				{ProductID: 2, UnitPrice: dec("50"), Quantity: 2},
+			},
+			discount: volume,
+			amount:   dec("40"),
+		},
+		{name: "未達消費門檻", lines: []CartLine{{ProductID: 1, UnitPrice: dec("999"), Quantity: 1}}, discount: spend, amount: dec("0")},
+		{name: "滿1000折100", lines: []CartLine{{ProductID: 1, UnitPrice: dec("500"), Quantity: 3}}, discount: spend, amount: dec("100")},
+		{name: "滿2000折250", lines: []CartLine{{ProductID: 1, UnitPrice: dec("1000"), Quantity: 2}}, discount: spend, amount: dec("250")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.Calculate(tt.lines, []models.Discount{tt.discount})
+			assert.Equal(t, tt.amount, result.TotalDiscount)
+			assert.Equal(t, result.Subtotal.Sub(tt.amount), result.Total)
+		})
+	}
+}
+
+func TestCreateDiscountWithTiers(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newDiscount := func(discountType models.DiscountType, tiers ...models.DiscountTier) *models.Discount {
+		return &models.Discount{
+			Name:      "Tiered",
+			Type:      discountType,
+			StartDate: now.Add(-1 * time.Hour),
+			EndDate:   now.Add(24 * time.Hour),
+			Tiers:     tiers,
+		}
+	}
+
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.MultiItem, models.DiscountTier{MinQuantity: 0, Percent: dec("10")})), ErrInvalidDiscountTier)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.MultiItem, models.DiscountTier{MinQuantity: 5, Percent: dec("110")})), ErrInvalidDiscountTier)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.Threshold,
+		models.DiscountTier{MinSpend: dec("1000"), Amount: dec("100")},
+		models.DiscountTier{MinSpend: dec("1000"), Amount: dec("150")},
+	)), ErrInvalidDiscountTier)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.Percentage, models.DiscountTier{MinQuantity: 5, Percent: dec("10")})), ErrInvalidDiscountTier)
+
+	// 級距與折扣一起儲存，套用時載入
+	assert.NoError(t, service.CreateDiscount(ctx, newDiscount(models.Threshold,
+		models.DiscountTier{MinSpend: dec("2000"), Amount: dec("250")},
+		models.DiscountTier{MinSpend: dec("1000"), Amount: dec("100")},
+	)))
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("700"), Quantity: 2}}
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("100"), application.DiscountTotal)
+
+	lines[0].Quantity = 3
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: lines})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("250"), application.DiscountTotal)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"shopping_cart/models"
+)
+
+var ErrExchangeRateUnavailable = errors.New("exchange rate unavailable")
+
+// ExchangeRateProvider 提供貨幣換算，讓折扣金額可以套用在不同貨幣的購物車
+type ExchangeRateProvider interface {
+	// Convert 將金額由 from 換算為 to，無法換算時回傳 ErrExchangeRateUnavailable
+	Convert(amount models.Decimal, from, to models.Currency, mode models.RoundingMode) (models.Decimal, error)
+}
+
+// StaticExchangeRates 以固定匯率表換算，匯率為一單位貨幣等於多少基準貨幣
+type StaticExchangeRates struct {
+	rates map[models.Currency]*big.Rat
+}
+
+// NewStaticExchangeRates 建立固定匯率表，例如 {"TWD": "1", "USD": "31.5"}。
+// 沒有任何匯率時不同貨幣一律無法換算
+func NewStaticExchangeRates(rates map[models.Currency]string) (*StaticExchangeRates, error) {
+	parsed := make(map[models.Currency]*big.Rat, len(rates))
+	for currency, value := range rates {
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q for %s", value, currency)
+		}
+		parsed[currency] = rate
+	}
+	return &StaticExchangeRates{rates: parsed}, nil
+}
+
+func (r *StaticExchangeRates) Convert(amount models.Decimal, from, to models.Currency, mode models.RoundingMode) (models.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, ok := r.rates[from]
+	if !ok {
+		return models.Decimal{}, fmt.Errorf("%w: %s to %s", ErrExchangeRateUnavailable, from, to)
+	}
+	toRate, ok := r.rates[to]
+	if !ok {
+		return models.Decimal{}, fmt.Errorf("%w: %s to %s", ErrExchangeRateUnavailable, from, to)
+	}
+
+	return amount.MulRat(new(big.Rat).Quo(fromRate, toRate), mode), nil
+}
+
+// localizeDiscount 回傳以購物車貨幣表示的折扣副本。
+// 固定金額、最高折抵金額與 CART_TOTAL 門檻優先使用該貨幣的設定值，否則以匯率換算；無法換算時回傳錯誤
+func localizeDiscount(discount models.Discount, currency models.Currency, rates ExchangeRateProvider, mode models.RoundingMode) (models.Discount, error) {
+	currency = currency.OrDefault()
+	from := discount.Currency.OrDefault()
+
+	var override *models.DiscountCurrencyValue
+	for i := range discount.CurrencyValues {
+		if discount.CurrencyValues[i].Currency == currency {
+			override = &discount.CurrencyValues[i]
+			break
+		}
+	}
+
+	convert := func(amount models.Decimal) (models.Decimal, error) {
+		if from == currency {
+			return amount, nil
+		}
+		if rates == nil {
+			return models.Decimal{}, fmt.Errorf("%w: %s to %s", ErrExchangeRateUnavailable, from, currency)
+		}
+		return rates.Convert(amount, from, currency, mode)
+	}
+
+	// 百分比、買N送N等類型的 Value 與貨幣無關
+	if discount.Type == models.Fixed || discount.Type == models.Threshold {
+		switch {
+		case override != nil && override.Amount.IsPositive():
+			discount.Value = override.Amount
+		default:
+			value, err := convert(discount.Value)
+			if err != nil {
+				return discount, err
+			}
+			discount.Value = value
+		}
+	}
+
+	// 最高折抵金額同樣以購物車的貨幣表示
+	switch {
+	case override != nil && override.MaxSavings.IsPositive():
+		discount.MaxSavings = override.MaxSavings
+	case discount.MaxSavings.IsPositive():
+		maxSavings, err := convert(discount.MaxSavings)
+		if err != nil {
+			return discount, err
+		}
+		discount.MaxSavings = maxSavings
+	}
+
+	// 組合售價同樣以購物車的貨幣表示
+	if discount.BundlePrice.IsPositive() && from != currency {
+		bundlePrice, err := convert(discount.BundlePrice)
+		if err != nil {
+			return discount, err
+		}
+		discount.BundlePrice = bundlePrice
+	}
+
+	// 消費級距的門檻與折抵金額以匯率換算
+	if discount.Type == models.Threshold && len(discount.Tiers) > 0 && from != currency {
+		tiers := make([]models.DiscountTier, len(discount.Tiers))
+		for i, tier := range discount.Tiers {
+			minSpend, err := convert(tier.MinSpend)
+			if err != nil {
+				return discount, err
+			}
+			amount, err := convert(tier.Amount)
+			if err != nil {
+				return discount, err
+			}
+			tier.MinSpend, tier.Amount = minSpend, amount
+			tiers[i] = tier
+		}
+		discount.Tiers = tiers
+	}
+
+	conditions := make([]models.DiscountCondition, len(discount.Conditions))
+	copy(conditions, discount.Conditions)
+	for i := range conditions {
+		if conditions[i].Type != models.CartTotal {
+			continue
+		}
+		if override != nil && override.MinCartTotal.IsPositive() {
+			conditions[i].Value = override.MinCartTotal.String()
+			continue
+		}
+		if from == currency {
+			continue
+		}
+		minTotal, err := models.ParseDecimal(conditions[i].Value)
+		if err != nil {
+			// 格式錯誤的條件交由條件評估回報
+			continue
+		}
+		converted, err := convert(minTotal)
+		if err != nil {
+			return discount, err
+		}
+		conditions[i].Value = converted.String()
+	}
+	discount.Conditions = conditions
+	discount.Currency = currency
+
+	return discount, nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticExchangeRates(t *testing.T) {
+	rates, err := NewStaticExchangeRates(map[models.Currency]string{models.TWD: "1", models.USD: "31.5"})
+	assert.NoError(t, err)
+
+	amount, err := rates.Convert(dec("10"), models.USD, models.TWD, models.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, dec("315"), amount)
+
+	// 100 / 31.5 = 3.1746...
+	amount, err = rates.Convert(dec("100"), models.TWD, models.USD, models.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, dec("3.17"), amount)
+
+	_, err = rates.Convert(dec("100"), models.TWD, "JPY", models.RoundHalfUp)
+	assert.ErrorIs(t, err, ErrExchangeRateUnavailable)
+
+	_, err = NewStaticExchangeRates(map[models.Currency]string{models.USD: "-1"})
+	assert.Error(t, err)
+}
+
+func TestApplyDiscountsInCartCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newDiscount := func(name string, value models.Decimal) *models.Discount {
+		discount := &models.Discount{
+			Name:      name,
+			Type:      models.Fixed,
+			Value:     value,
+			StartDate: now.Add(-1 * time.Hour),
+			EndDate:   now.Add(24 * time.Hour),
+			Stackable: true,
+		}
+		assert.NoError(t, service.CreateDiscount(ctx, discount))
+		return discount
+	}
+
+	perCurrency := newDiscount("300 Off", dec("300"))
+	converted := newDiscount("Spend 3000 Save 100", dec("100"))
+	db.Create(&models.DiscountCurrencyValue{DiscountID: perCurrency.ID, Currency: models.USD, Amount: dec("10")})
+	db.Create(&models.DiscountCondition{DiscountID: converted.ID, Type: models.CartTotal, Value: "3000"})
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("60"), Quantity: 2}}
+	usd := ApplyDiscountInput{Lines: lines, Currency: models.USD}
+
+	// 沒有匯率時只有設定了美元金額的折扣適用
+	application, err := service.ApplyDiscounts(ctx, usd)
+	assert.NoError(t, err)
+	assert.Equal(t, models.USD, application.Currency)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, perCurrency.ID, application.Applied[0].DiscountID)
+	assert.Equal(t, dec("110"), application.Total)
+	assert.Len(t, application.Rejected, 1)
+	assert.Equal(t, "discount has no value in currency USD", application.Rejected[0].Reason)
+
+	rates, err := NewStaticExchangeRates(map[models.Currency]string{models.TWD: "1", models.USD: "30"})
+	assert.NoError(t, err)
+	service = service.WithExchangeRates(rates)
+
+	// 門檻換算為 100 美元，折抵換算為 3.33 美元
+	application, err = service.ApplyDiscounts(ctx, usd)
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 2)
+	assert.Equal(t, dec("13.33"), application.DiscountTotal)
+	assert.Equal(t, dec("106.67"), application.Total)
+
+	// 換算後未達門檻
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{
+		Lines:    []CartLine{{ProductID: 1, UnitPrice: dec("40"), Quantity: 2}},
+		Currency: models.USD,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Equal(t, "cart total must be at least 100.00", application.Rejected[0].Reason)
+
+	// 預設貨幣的購物車使用原始金額
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: []CartLine{{ProductID: 1, UnitPrice: dec("1500"), Quantity: 2}}})
+	assert.NoError(t, err)
+	assert.Equal(t, models.TWD, application.Currency)
+	assert.Equal(t, dec("400"), application.DiscountTotal)
+
+	available, err := service.FindAvailableDiscounts(ctx, DiscountQuery{Lines: lines, Currency: models.USD})
+	assert.NoError(t, err)
+	assert.Len(t, available, 2)
+	for _, discount := range available {
+		assert.Equal(t, models.USD, discount.Currency)
+	}
+}
+
+func TestCheckoutRecordsCartCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	cartService := NewCartService(db)
+	checkoutService := NewCheckoutService(db, NewDiscountService(db))
+	ctx := context.Background()
+
+	_, err := cartService.CreateCartInCurrency(ctx, 1, "us")
+	assert.ErrorIs(t, err, models.ErrInvalidCurrency)
+
+	cart, err := cartService.CreateCartInCurrency(ctx, 1, "usd")
+	assert.NoError(t, err)
+	assert.Equal(t, models.USD, cart.Currency)
+
+	_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("20"), Quantity: 1})
+	assert.NoError(t, err)
+
+	order, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{}})
+	assert.NoError(t, err)
+	assert.Equal(t, models.USD, order.Currency)
+}
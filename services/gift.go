@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidGift    = errors.New("invalid gift discount")
+	ErrGiftOutOfStock = errors.New("gift out of stock")
+)
+
+// 贈品庫存不足的拒絕原因
+const reasonGiftOutOfStock = "gift out of stock"
+
+// giftProducts 回傳折扣的贈品
+func giftProducts(discount *models.Discount) []models.DiscountProduct {
+	gifts := make([]models.DiscountProduct, 0)
+	for _, p := range discount.Products {
+		if p.Gift {
+			gifts = append(gifts, p)
+		}
+	}
+	return gifts
+}
+
+func giftQuantity(p models.DiscountProduct) int {
+	if p.GiftQuantity <= 0 {
+		return 1
+	}
+	return p.GiftQuantity
+}
+
+// giftInStock 檢查每個贈品的庫存都足夠贈送
+func giftInStock(discount *models.Discount) bool {
+	for _, gift := range giftProducts(discount) {
+		if gift.GiftStock < giftQuantity(gift) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateGift 檢查贈品設定，只有 GIFT 折扣可以設定贈品
+func validateGift(discount *models.Discount) error {
+	gifts := giftProducts(discount)
+	if discount.Type != models.Gift {
+		if len(gifts) > 0 {
+			return fmt.Errorf("%w: gift products are only supported for %s discounts", ErrInvalidGift, models.Gift)
+		}
+		return nil
+	}
+
+	if len(gifts) == 0 {
+		return fmt.Errorf("%w: at least one gift product is required", ErrInvalidGift)
+	}
+	for _, gift := range gifts {
+		if gift.ProductID == 0 || gift.GiftQuantity < 0 || gift.GiftStock < 0 {
+			return fmt.Errorf("%w: gift products need a product and non-negative quantity and stock", ErrInvalidGift)
+		}
+	}
+	return nil
+}
+
+// addGiftLines 將折扣的贈品以零元明細加入計價結果
+func addGiftLines(result *PricingResult, discount *models.Discount) RuleDiscount {
+	for _, gift := range giftProducts(discount) {
+		result.Lines = append(result.Lines, LineBreakdown{
+			ProductID:      gift.ProductID,
+			Quantity:       giftQuantity(gift),
+			Discounts:      []RuleDiscount{},
+			GiftDiscountID: discount.ID,
+		})
+	}
+	return RuleDiscount{
+		DiscountID:   discount.ID,
+		DiscountName: discount.Name,
+		Type:         discount.Type,
+	}
+}
+
+// ConsumeGiftStock 結帳時扣除訂單贈品的庫存，任一贈品庫存不足時回傳 ErrGiftOutOfStock
+// 應在結帳交易中呼叫 (透過 WithTx)
+func (s *DiscountService) ConsumeGiftStock(ctx context.Context, items []models.OrderItem) error {
+	for _, item := range items {
+		if item.GiftDiscountID == 0 {
+			continue
+		}
+		// 以庫存作為條件扣除，避免並行結帳超送
+		result := s.db.WithContext(ctx).Model(&models.DiscountProduct{}).
+			Where("discount_id = ? AND product_id = ? AND gift = ? AND gift_stock >= ?", item.GiftDiscountID, item.ProductID, true, item.Quantity).
+			Update("gift_stock", gorm.Expr("gift_stock - ?", item.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: product %d", ErrGiftOutOfStock, item.ProductID)
+		}
+	}
+	return nil
+}
+
+// RestoreGiftStock 訂單取消或退款時歸還贈品庫存
+func (s *DiscountService) RestoreGiftStock(ctx context.Context, items []models.OrderItem) error {
+	for _, item := range items {
+		if item.GiftDiscountID == 0 {
+			continue
+		}
+		err := s.db.WithContext(ctx).Model(&models.DiscountProduct{}).
+			Where("discount_id = ? AND product_id = ? AND gift = ?", item.GiftDiscountID, item.ProductID, true).
+			Update("gift_stock", gorm.Expr("gift_stock + ?", item.Quantity)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithDiscountService 回傳在商品異動後依 GIFT 折扣自動加入或移除贈品的 CartService
+func (s *CartService) WithDiscountService(discounts *DiscountService) *CartService {
+	clone := *s
+	clone.discounts = discounts
+	return &clone
+}
+
+// SyncGifts 重新評估購物車的折扣，加入符合資格的贈品並移除不再符合資格的贈品。
+// 商品異動時會自動呼叫，套用或移除優惠碼等其他可能改變資格的操作後也應呼叫
+func (s *CartService) SyncGifts(ctx context.Context, cartID int64) error {
+	if s.discounts == nil {
+		return nil
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		cart := &models.Cart{}
+		err := tx.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Preload("Coupons").
+			First(cart, cartID).Error
+		if err != nil {
+			return err
+		}
+		if cart.Status != models.CartOpen {
+			return nil
+		}
+
+		coupons, err := NewCouponService(tx).CartCoupons(ctx, cart)
+		if err != nil {
+			return err
+		}
+		application, err := s.discounts.WithTx(tx).ApplyDiscounts(ctx, ApplyDiscountInput{
+			CartID:      cart.ID,
+			UserID:      cart.UserID,
+			Lines:       CartLines(cart),
+			Coupons:     coupons,
+			Currency:    cart.Currency,
+			ShippingFee: cart.ShippingFee,
+		})
+		if err != nil {
+			return err
+		}
+
+		type giftKey struct{ discountID, productID int64 }
+		wanted := make(map[giftKey]int)
+		order := make([]giftKey, 0)
+		for _, line := range application.Lines {
+			if line.GiftDiscountID == 0 {
+				continue
+			}
+			key := giftKey{line.GiftDiscountID, line.ProductID}
+			if _, ok := wanted[key]; !ok {
+				order = append(order, key)
+			}
+			wanted[key] += line.Quantity
+		}
+
+		for _, item := range cart.Items {
+			if item.GiftDiscountID == 0 {
+				continue
+			}
+			key := giftKey{item.GiftDiscountID, item.ProductID}
+			quantity, ok := wanted[key]
+			delete(wanted, key)
+			switch {
+			case !ok:
+				if err := tx.Delete(&models.CartItem{}, item.ID).Error; err != nil {
+					return err
+				}
+			case quantity != item.Quantity:
+				if err := tx.Model(&models.CartItem{}).Where("id = ?", item.ID).Update("quantity", quantity).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for _, key := range order {
+			quantity, ok := wanted[key]
+			if !ok {
+				continue
+			}
+			gift := &models.CartItem{
+				CartID:         cart.ID,
+				ProductID:      key.productID,
+				Quantity:       quantity,
+				GiftDiscountID: key.discountID,
+			}
+			if err := tx.Create(gift).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SyncUserGifts 重新同步用戶所有未結帳購物車的贈品，用於會員等級改變後
+func (s *CartService) SyncUserGifts(ctx context.Context, userID int64) error {
+	if s.discounts == nil {
+		return nil
+	}
+
+	var cartIDs []int64
+	err := s.db.WithContext(ctx).Model(&models.Cart{}).
+		Where("user_id = ? AND status = ?", userID, models.CartOpen).
+		Order("id").
+		Pluck("id", &cartIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, cartID := range cartIDs {
+		if err := s.SyncGifts(ctx, cartID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGiftWithPurchase(t *testing.T) {
+	db := setupTestDB(t)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db).WithDiscountService(discountService)
+	checkoutService := NewCheckoutService(db, discountService)
+	ctx := context.Background()
+	now := time.Now()
+
+	gift := &models.Discount{
+		Name:      "Spend 2000 Get a Tote",
+		Type:      models.Gift,
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+		Conditions: []models.DiscountCondition{
+			{Type: models.CartTotal, Value: "2000"},
+		},
+		Products: []models.DiscountProduct{
+			{ProductID: 900, Gift: true, GiftStock: 1},
+		},
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, gift))
+
+	giftItems := func(cart *models.Cart) []models.CartItem {
+		items := make([]models.CartItem, 0)
+		for _, item := range cart.Items {
+			if item.GiftDiscountID != 0 {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+
+	cart, err := cartService.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	cart, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("1500"), Quantity: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, giftItems(cart))
+
+	// 達到門檻時自動加入零元贈品
+	cart, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 2, UnitPrice: dec("500"), Quantity: 1})
+	assert.NoError(t, err)
+	gifts := giftItems(cart)
+	assert.Len(t, gifts, 1)
+	assert.Equal(t, int64(900), gifts[0].ProductID)
+	assert.Equal(t, gift.ID, gifts[0].GiftDiscountID)
+	assert.True(t, gifts[0].UnitPrice.IsZero())
+	assert.Equal(t, dec("2000"), cart.Subtotal)
+
+	// 不再符合資格時自動移除
+	assert.NoError(t, cartService.RemoveItem(ctx, cart.ID, 2))
+	cart, err = cartService.GetCart(ctx, cart.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, giftItems(cart))
+
+	cart, err = cartService.UpdateItemQuantity(ctx, cart.ID, 1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, giftItems(cart), 1)
+
+	order, err := checkoutService.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{gift.ID}})
+	assert.NoError(t, err)
+	assert.Len(t, order.Items, 2)
+	assert.Equal(t, gift.ID, order.Items[1].GiftDiscountID)
+	assert.Equal(t, dec("3000"), order.Total)
+
+	var stock models.DiscountProduct
+	db.Where("discount_id = ?", gift.ID).First(&stock)
+	assert.Equal(t, 0, stock.GiftStock)
+
+	// 贈品送完後不再加入
+	other, err := cartService.CreateCart(ctx, 2)
+	assert.NoError(t, err)
+	other, err = cartService.AddItem(ctx, other.ID, CartItemInput{ProductID: 1, UnitPrice: dec("2500"), Quantity: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, giftItems(other))
+
+	application, err := discountService.ApplyDiscounts(ctx, ApplyDiscountInput{CartID: other.ID, Lines: CartLines(other)})
+	assert.NoError(t, err)
+	assert.Equal(t, "gift out of stock", application.Rejected[0].Reason)
+
+	// 取消訂單時歸還庫存
+	_, err = checkoutService.CancelOrder(ctx, order.ID)
+	assert.NoError(t, err)
+	db.Where("discount_id = ?", gift.ID).First(&stock)
+	assert.Equal(t, 1, stock.GiftStock)
+
+	// 更新折扣補充贈品庫存
+	assert.NoError(t, discountService.UpdateDiscount(ctx, gift.ID, &models.Discount{
+		StartDate: gift.StartDate,
+		EndDate:   gift.EndDate,
+		Products:  []models.DiscountProduct{{ProductID: 900, Gift: true, GiftStock: 10}},
+	}))
+	var refilled models.DiscountProduct
+	db.Where("discount_id = ?", gift.ID).First(&refilled)
+	assert.Equal(t, 10, refilled.GiftStock)
+}
+
+func TestGiftValidation(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDiscountService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	newDiscount := func(discountType models.DiscountType, products ...models.DiscountProduct) *models.Discount {
+		return &models.Discount{
+			Name:      "Gift",
+			Type:      discountType,
+			StartDate: now.Add(-1 * time.Hour),
+			EndDate:   now.Add(24 * time.Hour),
+			Products:  products,
+		}
+	}
+
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.Gift)), ErrInvalidGift)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.Gift, models.DiscountProduct{ProductID: 900, Gift: true, GiftStock: -1})), ErrInvalidGift)
+	assert.ErrorIs(t, service.CreateDiscount(ctx, newDiscount(models.Percentage, models.DiscountProduct{ProductID: 900, Gift: true})), ErrInvalidGift)
+
+	// 限定商品與贈品可以同時設定，贈品不算適用商品
+	assert.NoError(t, service.CreateDiscount(ctx, newDiscount(models.Gift,
+		models.DiscountProduct{ProductID: 1},
+		models.DiscountProduct{ProductID: 900, Gift: true, GiftQuantity: 2, GiftStock: 10},
+	)))
+
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: []CartLine{{ProductID: 900, UnitPrice: dec("100"), Quantity: 1}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "no eligible products in cart", application.Rejected[0].Reason)
+
+	application, err = service.ApplyDiscounts(ctx, ApplyDiscountInput{Lines: []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 1}}})
+	assert.NoError(t, err)
+	assert.Len(t, application.Applied, 1)
+	assert.Len(t, application.Lines, 2)
+	assert.Equal(t, 2, application.Lines[1].Quantity)
+	assert.Equal(t, dec("100"), application.Total)
+}
+
+func TestGiftSyncsWhenQualificationChanges(t *testing.T) {
+	db := setupTestDB(t)
+	membershipService := NewMembershipService(db)
+	discountService := NewDiscountService(db)
+	cartService := NewCartService(db).WithDiscountService(discountService)
+	couponService := NewCouponService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	couponGift := &models.Discount{
+		Name:           "Coupon Tote",
+		Type:           models.Gift,
+		StartDate:      now.Add(-1 * time.Hour),
+		EndDate:        now.Add(24 * time.Hour),
+		RequiresCoupon: true,
+		Products:       []models.DiscountProduct{{ProductID: 900, Gift: true, GiftStock: 5}},
+	}
+	goldGift := &models.Discount{
+		Name:       "Gold Mug",
+		Type:       models.Gift,
+		StartDate:  now.Add(-1 * time.Hour),
+		EndDate:    now.Add(24 * time.Hour),
+		Conditions: []models.DiscountCondition{{Type: models.MembershipLevel, Value: "GOLD"}},
+		Products:   []models.DiscountProduct{{ProductID: 901, Gift: true, GiftStock: 5}},
+	}
+	assert.NoError(t, discountService.CreateDiscount(ctx, couponGift))
+	assert.NoError(t, discountService.CreateDiscount(ctx, goldGift))
+	assert.NoError(t, couponService.CreateCoupon(ctx, &models.Coupon{DiscountID: couponGift.ID, Code: "TOTE"}))
+
+	giftProductIDs := func(cartID int64) []int64 {
+		cart, err := cartService.GetCart(ctx, cartID)
+		assert.NoError(t, err)
+		ids := make([]int64, 0)
+		for _, item := range cart.Items {
+			if item.GiftDiscountID != 0 {
+				ids = append(ids, item.ProductID)
+			}
+		}
+		return ids
+	}
+
+	cart, err := cartService.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	_, err = cartService.AddItem(ctx, cart.ID, CartItemInput{ProductID: 1, UnitPrice: dec("100"), Quantity: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, giftProductIDs(cart.ID))
+
+	// 套用與移除優惠碼
+	_, err = couponService.ApplyCoupon(ctx, cart.ID, "tote")
+	assert.NoError(t, err)
+	assert.NoError(t, cartService.SyncGifts(ctx, cart.ID))
+	assert.Equal(t, []int64{900}, giftProductIDs(cart.ID))
+
+	assert.NoError(t, couponService.RemoveCoupon(ctx, cart.ID, "TOTE"))
+	assert.NoError(t, cartService.SyncGifts(ctx, cart.ID))
+	assert.Empty(t, giftProductIDs(cart.ID))
+
+	// 會員等級改變
+	_, err = membershipService.SetMembershipTier(ctx, 1, "GOLD")
+	assert.NoError(t, err)
+	assert.NoError(t, cartService.SyncUserGifts(ctx, 1))
+	assert.Equal(t, []int64{901}, giftProductIDs(cart.ID))
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidMembershipTier = errors.New("invalid membership tier")
+
+// MembershipProvider 提供用戶的會員等級，訪客 (userID 為 0) 回傳空字串
+type MembershipProvider interface {
+	GetMembershipTier(ctx context.Context, userID int64) (models.MembershipTier, error)
+}
+
+// MembershipService 以資料庫保存會員等級，是預設的 MembershipProvider
+type MembershipService struct {
+	db *gorm.DB
+}
+
+func NewMembershipService(db *gorm.DB) *MembershipService {
+	return &MembershipService{db: db}
+}
+
+// GetMembershipTier 回傳用戶的會員等級，沒有紀錄的用戶視為一般會員
+func (s *MembershipService) GetMembershipTier(ctx context.Context, userID int64) (models.MembershipTier, error) {
+	if userID == 0 {
+		return "", nil
+	}
+
+	var membership models.UserMembership
+	err := s.db.WithContext(ctx).First(&membership, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.MembershipRegular, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return membership.Tier, nil
+}
+
+func (s *MembershipService) SetMembershipTier(ctx context.Context, userID int64, value string) (*models.UserMembership, error) {
+	tier, ok := models.ParseMembershipTier(value)
+	if !ok || userID == 0 {
+		return nil, ErrInvalidMembershipTier
+	}
+
+	membership := &models.UserMembership{
+		UserID:    userID,
+		Tier:      tier,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tier", "updated_at"}),
+	}).Create(membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// StaticMembershipProvider 記憶體內的會員等級表，未列出的用戶視為一般會員
+type StaticMembershipProvider map[int64]models.MembershipTier
+
+func (p StaticMembershipProvider) GetMembershipTier(ctx context.Context, userID int64) (models.MembershipTier, error) {
+	if userID == 0 {
+		return "", nil
+	}
+	if tier, ok := p[userID]; ok {
+		return tier, nil
+	}
+	return models.MembershipRegular, nil
+}
+
+// membershipSatisfied 檢查會員等級條件，條件值無法辨識時視為不符合
+func membershipSatisfied(tier models.MembershipTier, condition models.DiscountCondition) bool {
+	required, ok := models.ParseMembershipTier(condition.Value)
+	return ok && tier.Satisfies(required)
+}
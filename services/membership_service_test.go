@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembershipTierOrdering(t *testing.T) {
+	assert.True(t, models.MembershipPlatinum.Satisfies(models.MembershipGold))
+	assert.True(t, models.MembershipGold.Satisfies(models.MembershipGold))
+	assert.False(t, models.MembershipSilver.Satisfies(models.MembershipGold))
+	assert.False(t, models.MembershipTier("").Satisfies(models.MembershipRegular), "訪客不符合任何會員等級")
+	assert.False(t, models.MembershipPlatinum.Satisfies("DIAMOND"), "未知的等級條件不應通過")
+
+	tier, ok := models.ParseMembershipTier(" gold ")
+	assert.True(t, ok)
+	assert.Equal(t, models.MembershipGold, tier)
+}
+
+func TestMembershipService(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewMembershipService(db)
+	ctx := context.Background()
+
+	// 沒有紀錄的用戶為一般會員，訪客沒有等級
+	tier, err := service.GetMembershipTier(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MembershipRegular, tier)
+
+	tier, err = service.GetMembershipTier(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MembershipTier(""), tier)
+
+	_, err = service.SetMembershipTier(ctx, 1, "gold")
+	assert.NoError(t, err)
+	tier, err = service.GetMembershipTier(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MembershipGold, tier)
+
+	// 重複設定會更新等級
+	_, err = service.SetMembershipTier(ctx, 1, "PLATINUM")
+	assert.NoError(t, err)
+	tier, err = service.GetMembershipTier(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MembershipPlatinum, tier)
+
+	_, err = service.SetMembershipTier(ctx, 1, "DIAMOND")
+	assert.ErrorIs(t, err, ErrInvalidMembershipTier)
+}
+
+func TestGetAvailableDiscountsByMembershipTier(t *testing.T) {
+	db := setupTestDB(t)
+	provider := StaticMembershipProvider{
+		1: models.MembershipSilver,
+		2: models.MembershipGold,
+		3: models.MembershipPlatinum,
+	}
+	service := NewDiscountService(db).WithMembershipProvider(provider)
+	ctx := context.Background()
+	now := time.Now()
+
+	goldDeal := &models.Discount{
+		Name:      "Gold Deal",
+		Type:      models.Percentage,
+		Value:     dec("10"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+	}
+	openDeal := &models.Discount{
+		Name:      "Open Deal",
+		Type:      models.Fixed,
+		Value:     dec("5"),
+		StartDate: now.Add(-1 * time.Hour),
+		EndDate:   now.Add(24 * time.Hour),
+	}
+	assert.NoError(t, service.CreateDiscount(ctx, goldDeal))
+	assert.NoError(t, service.CreateDiscount(ctx, openDeal))
+	db.Create(&models.DiscountCondition{DiscountID: goldDeal.ID, Type: models.MembershipLevel, Value: "GOLD"})
+
+	tests := []struct {
+		name     string
+		userID   int64
+		expected []string
+	}{
+		{name: "訪客", userID: 0, expected: []string{"Open Deal"}},
+		{name: "銀卡會員", userID: 1, expected: []string{"Open Deal"}},
+		{name: "金卡會員", userID: 2, expected: []string{"Gold Deal", "Open Deal"}},
+		{name: "白金會員也能使用金卡優惠", userID: 3, expected: []string{"Gold Deal", "Open Deal"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discounts, err := service.GetAvailableDiscounts(ctx, tt.userID, dec("0"), []int64{})
+			assert.NoError(t, err)
+
+			names := make([]string, 0, len(discounts))
+			for _, d := range discounts {
+				names = append(names, d.Name)
+			}
+			assert.ElementsMatch(t, tt.expected, names)
+		})
+	}
+
+	// 套用到購物車時回報原因
+	application, err := service.ApplyDiscounts(ctx, ApplyDiscountInput{
+		UserID: 1,
+		Lines:  []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 1}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, application.Rejected, 1)
+	assert.Equal(t, "membership tier GOLD required", application.Rejected[0].Reason)
+}
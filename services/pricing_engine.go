@@ -0,0 +1,362 @@
+package services
+
+import (
+	"shopping_cart/models"
+)
+
+// 計價引擎使用的購物車明細
+type CartLine struct {
+	ProductID int64          `json:"product_id"`
+	UnitPrice models.Decimal `json:"unit_price"`
+	Quantity  int            `json:"quantity"`
+	Category  string         `json:"category,omitempty"`
+	Brand     string         `json:"brand,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+}
+
+// 折抵金額被限制的原因
+type SavingsCap string
+
+const (
+	CapMaxSavings SavingsCap = "MAX_SAVINGS" // 達到折扣的最高折抵金額
+	CapLineFloor  SavingsCap = "LINE_FLOOR"  // 明細金額不可低於下限
+	CapCartFloor  SavingsCap = "CART_FLOOR"  // 購物車金額不可低於下限
+)
+
+// 單一折扣規則的折抵金額
+type RuleDiscount struct {
+	DiscountID   int64               `json:"discount_id"`
+	DiscountName string              `json:"discount_name"`
+	Type         models.DiscountType `json:"type"`
+	Amount       models.Decimal      `json:"amount"`
+	Caps         []SavingsCap        `json:"caps,omitempty"` // 折抵金額被限制的原因，依套用順序
+}
+
+// 每一筆明細的計價結果
+type LineBreakdown struct {
+	ProductID      int64          `json:"product_id"`
+	Category       string         `json:"category,omitempty"`
+	Brand          string         `json:"brand,omitempty"`
+	Tags           []string       `json:"tags,omitempty"`
+	UnitPrice      models.Decimal `json:"unit_price"`
+	Quantity       int            `json:"quantity"`
+	Subtotal       models.Decimal `json:"subtotal"`
+	Discounts      []RuleDiscount `json:"discounts"`
+	DiscountTotal  models.Decimal `json:"discount_total"`
+	Total          models.Decimal `json:"total"`
+	GiftDiscountID int64          `json:"gift_discount_id,omitempty"` // GIFT 折扣加入的零元贈品
+}
+
+// 運費的計價結果
+type ShippingBreakdown struct {
+	Fee           models.Decimal `json:"fee"`
+	Discounts     []RuleDiscount `json:"discounts"`
+	DiscountTotal models.Decimal `json:"discount_total"`
+	Total         models.Decimal `json:"total"`
+}
+
+// 整台購物車的計價結果
+type PricingResult struct {
+	Lines         []LineBreakdown   `json:"lines"`
+	Shipping      ShippingBreakdown `json:"shipping"`
+	Rules         []RuleDiscount    `json:"rules"` // 依套用順序彙總每個規則的折抵金額
+	Subtotal      models.Decimal    `json:"subtotal"`
+	TotalDiscount models.Decimal    `json:"total_discount"` // 商品與運費折扣的合計
+	Total         models.Decimal    `json:"total"`          // 小計加運費減折扣
+}
+
+// PricingEngine 以定點小數計價。每個折扣在每筆明細上各自捨入到兩位小數，
+// 固定金額分攤到多筆明細時最後一筆吸收捨入差額，確保明細加總等於折扣金額
+type PricingEngine struct {
+	rounding     models.RoundingMode
+	minLineTotal models.Decimal // 每筆明細折扣後的最低應付金額
+	minCartTotal models.Decimal // 整台購物車折扣後的最低應付金額
+}
+
+func NewPricingEngine() *PricingEngine {
+	return &PricingEngine{rounding: models.RoundHalfUp}
+}
+
+// WithRounding 回傳使用指定捨入模式的 PricingEngine
+func (e *PricingEngine) WithRounding(mode models.RoundingMode) *PricingEngine {
+	clone := *e
+	clone.rounding = mode
+	return &clone
+}
+
+// WithPriceFloors 回傳折扣後明細與購物車金額不低於指定下限的 PricingEngine，預設下限為 0
+func (e *PricingEngine) WithPriceFloors(minLineTotal, minCartTotal models.Decimal) *PricingEngine {
+	clone := *e
+	clone.minLineTotal = models.MaxDecimal(minLineTotal, models.Decimal{})
+	clone.minCartTotal = models.MaxDecimal(minCartTotal, models.Decimal{})
+	return &clone
+}
+
+// Calculate 計算沒有運費的購物車
+func (e *PricingEngine) Calculate(lines []CartLine, discounts []models.Discount) *PricingResult {
+	return e.CalculateWithShipping(lines, models.Decimal{}, discounts)
+}
+
+// CalculateWithShipping 依 discounts 的順序逐一套用折扣，每個折扣都以前一個折扣後的剩餘金額計算
+// 運費折扣只折抵運費，商品折扣只折抵商品，兩者互不影響
+func (e *PricingEngine) CalculateWithShipping(lines []CartLine, shippingFee models.Decimal, discounts []models.Discount) *PricingResult {
+	result := &PricingResult{
+		Lines: make([]LineBreakdown, len(lines)),
+		Shipping: ShippingBreakdown{
+			Fee:       shippingFee,
+			Discounts: []RuleDiscount{},
+			Total:     shippingFee,
+		},
+		Rules: make([]RuleDiscount, 0, len(discounts)),
+	}
+
+	for i, line := range lines {
+		subtotal := line.UnitPrice.Mul(int64(line.Quantity))
+		result.Lines[i] = LineBreakdown{
+			ProductID: line.ProductID,
+			Category:  line.Category,
+			Brand:     line.Brand,
+			Tags:      line.Tags,
+			UnitPrice: line.UnitPrice,
+			Quantity:  line.Quantity,
+			Subtotal:  subtotal,
+			Discounts: []RuleDiscount{},
+			Total:     subtotal,
+		}
+		result.Subtotal = result.Subtotal.Add(subtotal)
+	}
+
+	// 組合折扣共用購物車中的商品，先決定每個組合湊成的組數
+	packing := e.packBundles(result.Lines, discounts)
+	consumed := make(map[int]int)
+
+	for i := range discounts {
+		discount := &discounts[i]
+		if discount.Type == models.Gift {
+			result.Rules = append(result.Rules, addGiftLines(result, discount))
+			continue
+		}
+		if discount.Type.IsShipping() {
+			if rule := e.applyShippingDiscount(&result.Shipping, discount); rule.Amount.IsPositive() {
+				result.Rules = append(result.Rules, rule)
+				result.TotalDiscount = result.TotalDiscount.Add(rule.Amount)
+			}
+			continue
+		}
+
+		eligible := eligibleLines(result.Lines, discount)
+		if len(eligible) == 0 {
+			continue
+		}
+
+		var amounts map[int]models.Decimal
+		if discount.Type == models.Bundle {
+			amounts = make(map[int]models.Decimal, len(eligible))
+			e.bundleAmounts(result.Lines, eligible, discount, packing[discount.ID], consumed, amounts)
+		} else {
+			amounts = e.lineAmounts(result.Lines, eligible, discount)
+		}
+
+		rule := RuleDiscount{
+			DiscountID:   discount.ID,
+			DiscountName: discount.Name,
+			Type:         discount.Type,
+		}
+
+		// 依序套用明細下限、折扣的最高折抵金額與購物車下限
+		clamped := false
+		for _, idx := range eligible {
+			limit := models.MaxDecimal(result.Lines[idx].Total.Sub(e.minLineTotal), models.Decimal{})
+			if amounts[idx].GreaterThan(limit) {
+				amounts[idx] = limit
+				clamped = true
+			}
+		}
+		if clamped {
+			rule.Caps = append(rule.Caps, CapLineFloor)
+		}
+		if discount.MaxSavings.IsPositive() && e.capAmounts(eligible, amounts, discount.MaxSavings) {
+			rule.Caps = append(rule.Caps, CapMaxSavings)
+		}
+		// 購物車下限只看商品金額，運費折扣不計入
+		merchandise := result.Subtotal.Sub(result.TotalDiscount.Sub(result.Shipping.DiscountTotal))
+		remaining := merchandise.Sub(e.minCartTotal)
+		if e.capAmounts(eligible, amounts, models.MaxDecimal(remaining, models.Decimal{})) {
+			rule.Caps = append(rule.Caps, CapCartFloor)
+		}
+
+		for _, idx := range eligible {
+			amount := amounts[idx]
+			if !amount.IsPositive() {
+				continue
+			}
+
+			line := &result.Lines[idx]
+			line.Discounts = append(line.Discounts, RuleDiscount{
+				DiscountID:   discount.ID,
+				DiscountName: discount.Name,
+				Type:         discount.Type,
+				Amount:       amount,
+			})
+			line.DiscountTotal = line.DiscountTotal.Add(amount)
+			line.Total = line.Total.Sub(amount)
+			rule.Amount = rule.Amount.Add(amount)
+		}
+
+		if rule.Amount.IsPositive() {
+			result.Rules = append(result.Rules, rule)
+			result.TotalDiscount = result.TotalDiscount.Add(rule.Amount)
+		}
+	}
+
+	result.Total = result.Subtotal.Add(result.Shipping.Fee).Sub(result.TotalDiscount)
+
+	return result
+}
+
+// applyShippingDiscount 以剩餘運費計算運費折扣
+func (e *PricingEngine) applyShippingDiscount(shipping *ShippingBreakdown, discount *models.Discount) RuleDiscount {
+	rule := RuleDiscount{
+		DiscountID:   discount.ID,
+		DiscountName: discount.Name,
+		Type:         discount.Type,
+	}
+	if !shipping.Total.IsPositive() {
+		return rule
+	}
+
+	amount := shipping.Total
+	if discount.Type == models.ShippingPercent {
+		amount = models.MinDecimal(shipping.Total.Percent(discount.Value, e.rounding), shipping.Total)
+	}
+	if discount.MaxSavings.IsPositive() && amount.GreaterThan(discount.MaxSavings) {
+		amount = discount.MaxSavings
+		rule.Caps = append(rule.Caps, CapMaxSavings)
+	}
+	if !amount.IsPositive() {
+		return rule
+	}
+
+	rule.Amount = amount
+	shipping.Discounts = append(shipping.Discounts, rule)
+	shipping.DiscountTotal = shipping.DiscountTotal.Add(amount)
+	shipping.Total = shipping.Total.Sub(amount)
+	return rule
+}
+
+// lineAmounts 計算單一折扣在各適用明細上的折抵金額 (尚未套用上限與下限)
+func (e *PricingEngine) lineAmounts(lines []LineBreakdown, eligible []int, discount *models.Discount) map[int]models.Decimal {
+	amounts := make(map[int]models.Decimal, len(eligible))
+
+	// 設定階梯級距的 MULTI_ITEM 與 THRESHOLD 依級距計算
+	if len(discount.Tiers) > 0 && (discount.Type == models.MultiItem || discount.Type == models.Threshold) {
+		e.tieredAmounts(lines, eligible, discount, amounts)
+		return amounts
+	}
+
+	switch discount.Type {
+	case models.Percentage:
+		for _, idx := range eligible {
+			amounts[idx] = lines[idx].Total.Percent(discount.Value, e.rounding)
+		}
+
+	case models.Fixed, models.Threshold:
+		// 固定金額以明細剩餘金額比例分攤
+		e.allocateProportionally(lines, eligible, discount.Value, amounts)
+
+	case models.BOGO:
+		e.bogoAmounts(lines, eligible, discount, amounts)
+
+	case models.MultiItem:
+		// 第二件 (以及第四件、第六件...) 以 Value% 計價
+		for _, idx := range eligible {
+			line := lines[idx]
+			discountedUnits := line.Quantity / 2
+			discounted := line.UnitPrice.Mul(int64(discountedUnits))
+			amounts[idx] = discounted.Percent(models.NewDecimal(100).Sub(discount.Value), e.rounding)
+		}
+	}
+
+	return amounts
+}
+
+// capAmounts 當各明細折抵金額合計超過 limit 時，依原本的比例縮減到 limit，有縮減時回傳 true
+func (e *PricingEngine) capAmounts(eligible []int, amounts map[int]models.Decimal, limit models.Decimal) bool {
+	var total models.Decimal
+	for _, idx := range eligible {
+		total = total.Add(amounts[idx])
+	}
+	if !total.GreaterThan(limit) {
+		return false
+	}
+
+	remaining := limit
+	for i, idx := range eligible {
+		share := limit.Ratio(amounts[idx], total, e.rounding)
+		if i == len(eligible)-1 {
+			// 最後一筆吸收捨入差額，但不超過原本的折抵金額
+			share = models.MinDecimal(remaining, amounts[idx])
+		}
+		share = models.MinDecimal(share, remaining)
+		amounts[idx] = share
+		remaining = remaining.Sub(share)
+	}
+	return true
+}
+
+// eligibleLines 回傳折扣適用的明細索引，依折扣的商品、類別、品牌與標籤規則篩選，
+// 未限定範圍的折扣適用整台購物車
+func eligibleLines(lines []LineBreakdown, discount *models.Discount) []int {
+	rules := newTargetRules(discount)
+	matches := func(line LineBreakdown) bool {
+		return rules.matches(line.ProductID, line.Category, line.Brand, line.Tags)
+	}
+
+	// 組合折扣只適用組合中的商品
+	if discount.Type == models.Bundle {
+		products := make(map[int64]bool, len(discount.BundleItems))
+		for _, item := range discount.BundleItems {
+			products[item.ProductID] = true
+		}
+		matches = func(line LineBreakdown) bool { return products[line.ProductID] }
+	}
+
+	// 買A送B 的贈送商品也參與計價
+	if discount.Type == models.BOGO && discount.BOGORule != nil && discount.BOGORule.Mode == models.BOGOCrossProduct && rules.restricted() {
+		getProductID := discount.BOGORule.GetProductID
+		qualifies := matches
+		matches = func(line LineBreakdown) bool { return line.ProductID == getProductID || qualifies(line) }
+	}
+
+	eligible := make([]int, 0, len(lines))
+	for i, line := range lines {
+		if !line.Total.IsPositive() || !matches(line) {
+			continue
+		}
+		eligible = append(eligible, i)
+	}
+	return eligible
+}
+
+// allocateProportionally 將固定金額依剩餘金額比例分攤，最後一筆吸收捨入差額
+func (e *PricingEngine) allocateProportionally(lines []LineBreakdown, eligible []int, amount models.Decimal, amounts map[int]models.Decimal) {
+	var base models.Decimal
+	for _, idx := range eligible {
+		base = base.Add(lines[idx].Total)
+	}
+	if !base.IsPositive() {
+		return
+	}
+
+	// 超過剩餘金額的部分由明細下限截斷並回報
+	remaining := amount
+	for i, idx := range eligible {
+		if i == len(eligible)-1 {
+			amounts[idx] = remaining
+			break
+		}
+		share := amount.Ratio(lines[idx].Total, base, e.rounding)
+		amounts[idx] = share
+		remaining = remaining.Sub(share)
+	}
+}
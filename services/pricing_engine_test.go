@@ -0,0 +1,346 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPricingEngineDiscountTypes(t *testing.T) {
+	engine := NewPricingEngine()
+
+	tests := []struct {
+		name     string
+		lines    []CartLine
+		discount models.Discount
+		expected models.Decimal // 預期折扣後總額
+	}{
+		{
+			name:     "百分比折扣",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Percentage, Value: dec("10")},
+			expected: dec("180"),
+		},
+		{
+			name:     "固定金額折扣",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("200"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Fixed, Value: dec("50")},
+			expected: dec("150"),
+		},
+		{
+			name:     "固定金額不可低於零",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("30"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Fixed, Value: dec("50")},
+			expected: dec("0"),
+		},
+		{
+			name:     "滿額折扣",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("600"), Quantity: 2}},
+			discount: models.Discount{ID: 1, Type: models.Threshold, Value: dec("100")},
+			expected: dec("1100"),
+		},
+		{
+			name:     "買一送一",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 4}},
+			discount: models.Discount{ID: 1, Type: models.BOGO, Value: dec("1")},
+			expected: dec("200"),
+		},
+		{
+			name:     "買一送一奇數件",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 3}},
+			discount: models.Discount{ID: 1, Type: models.BOGO, Value: dec("1")},
+			expected: dec("200"),
+		},
+		{
+			name:     "第二件5折",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 3}},
+			discount: models.Discount{ID: 1, Type: models.MultiItem, Value: dec("50")},
+			expected: dec("250"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.Calculate(tt.lines, []models.Discount{tt.discount})
+			assert.Equal(t, tt.expected, result.Total)
+			assert.Equal(t, result.Subtotal.Sub(result.Total), result.TotalDiscount)
+		})
+	}
+}
+
+func TestPricingEngineLineBreakdown(t *testing.T) {
+	engine := NewPricingEngine()
+
+	lines := []CartLine{
+		{ProductID: 1, UnitPrice: dec("100"), Quantity: 2}, // 200
+		{ProductID: 2, UnitPrice: dec("50"), Quantity: 4},  // 200
+	}
+	discounts := []models.Discount{
+		{ID: 1, Name: "Product 1 BOGO", Type: models.BOGO, Value: dec("1"), Products: []models.DiscountProduct{{ProductID: 1}}},
+		{ID: 2, Name: "Cart 10%", Type: models.Percentage, Value: dec("10")},
+		{ID: 3, Name: "Cart 30 off", Type: models.Fixed, Value: dec("30")},
+	}
+
+	result := engine.Calculate(lines, discounts)
+
+	assert.Equal(t, dec("400"), result.Subtotal)
+
+	// 商品1: 200 -> 買一送一 100 -> 10% 90 -> 分攤 30 中的 10
+	assert.Len(t, result.Lines[0].Discounts, 3)
+	assert.Equal(t, dec("100"), result.Lines[0].Discounts[0].Amount)
+	assert.Equal(t, dec("10"), result.Lines[0].Discounts[1].Amount)
+	assert.Equal(t, dec("10"), result.Lines[0].Discounts[2].Amount)
+	assert.Equal(t, dec("80"), result.Lines[0].Total)
+
+	// 商品2: 200 -> 10% 180 -> 分攤 30 中的 20
+	assert.Len(t, result.Lines[1].Discounts, 2)
+	assert.Equal(t, dec("20"), result.Lines[1].Discounts[0].Amount)
+	assert.Equal(t, dec("20"), result.Lines[1].Discounts[1].Amount)
+	assert.Equal(t, dec("160"), result.Lines[1].Total)
+
+	// 每個規則的彙總
+	assert.Len(t, result.Rules, 3)
+	assert.Equal(t, dec("100"), result.Rules[0].Amount)
+	assert.Equal(t, dec("30"), result.Rules[1].Amount)
+	assert.Equal(t, dec("30"), result.Rules[2].Amount)
+
+	assert.Equal(t, dec("160"), result.TotalDiscount)
+	assert.Equal(t, dec("240"), result.Total)
+}
+
+func TestPricingEngineSkipsUnmatchedProducts(t *testing.T) {
+	engine := NewPricingEngine()
+
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 1}}
+	discounts := []models.Discount{
+		{ID: 1, Type: models.Percentage, Value: dec("50"), Products: []models.DiscountProduct{{ProductID: 2}}},
+	}
+
+	result := engine.Calculate(lines, discounts)
+	assert.Empty(t, result.Rules)
+	assert.Equal(t, dec("100"), result.Total)
+}
+
+func TestPricingEngineRounding(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     models.RoundingMode
+		lines    []CartLine
+		discount models.Discount
+		amount   models.Decimal // 預期折抵金額
+	}{
+		{
+			name:     "不會出現 89.99999 的誤差",
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("99.99"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Percentage, Value: dec("10")},
+			amount:   dec("10.00"), // 9.999 -> 10.00
+		},
+		{
+			name:     "四捨五入",
+			mode:     models.RoundHalfUp,
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("0.25"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Percentage, Value: dec("10")},
+			amount:   dec("0.03"), // 0.025 -> 0.03
+		},
+		{
+			name:     "銀行家捨入",
+			mode:     models.RoundHalfEven,
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("0.25"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Percentage, Value: dec("10")},
+			amount:   dec("0.02"), // 0.025 -> 0.02
+		},
+		{
+			name:     "銀行家捨入到偶數",
+			mode:     models.RoundHalfEven,
+			lines:    []CartLine{{ProductID: 1, UnitPrice: dec("0.35"), Quantity: 1}},
+			discount: models.Discount{ID: 1, Type: models.Percentage, Value: dec("10")},
+			amount:   dec("0.04"), // 0.035 -> 0.04
+		},
+		{
+			name: "每筆明細各自捨入",
+			mode: models.RoundHalfUp,
+			lines: []CartLine{
+				{ProductID: 1, UnitPrice: dec("0.05"), Quantity: 1},
+				{ProductID: 2, UnitPrice: dec("0.05"), Quantity: 1},
+			},
+			discount: models.Discount{ID: 1, Type: models.Percentage, Value: dec("50")},
+			amount:   dec("0.06"), // 每筆 0.025 -> 0.03
+		},
+		{
+			name: "固定金額分攤後加總不變",
+			mode: models.RoundHalfEven,
+			lines: []CartLine{
+				{ProductID: 1, UnitPrice: dec("10"), Quantity: 1},
+				{ProductID: 2, UnitPrice: dec("10"), Quantity: 1},
+				{ProductID: 3, UnitPrice: dec("10"), Quantity: 1},
+			},
+			discount: models.Discount{ID: 1, Type: models.Fixed, Value: dec("10")},
+			amount:   dec("10"), // 3.33 + 3.33 + 3.34
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewPricingEngine().WithRounding(tt.mode).Calculate(tt.lines, []models.Discount{tt.discount})
+			assert.Equal(t, tt.amount, result.TotalDiscount)
+			assert.Equal(t, result.Subtotal.Sub(tt.amount), result.Total)
+
+			var lineTotal models.Decimal
+			for _, line := range result.Lines {
+				lineTotal = lineTotal.Add(line.DiscountTotal)
+			}
+			assert.Equal(t, result.TotalDiscount, lineTotal)
+		})
+	}
+}
+
+func TestPricingResultJSON(t *testing.T) {
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("0.1"), Quantity: 3}}
+	discounts := []models.Discount{{ID: 1, Type: models.Percentage, Value: dec("12.5")}}
+	result := NewPricingEngine().Calculate(lines, discounts)
+
+	data, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"subtotal":0.30`)
+	assert.Contains(t, string(data), `"total":0.26`)
+
+	// JSON 往返後金額完全相同
+	var decoded PricingResult
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, result.Subtotal, decoded.Subtotal)
+	assert.Equal(t, result.TotalDiscount, decoded.TotalDiscount)
+	assert.Equal(t, result.Lines[0].UnitPrice, decoded.Lines[0].UnitPrice)
+
+	// 字串形式的金額也可以解析，超過兩位小數則拒絕
+	var line CartLine
+	assert.NoError(t, json.Unmarshal([]byte(`{"product_id":1,"unit_price":"19.90","quantity":1}`), &line))
+	assert.Equal(t, dec("19.9"), line.UnitPrice)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"unit_price":19.999}`), &line), models.ErrInvalidDecimal)
+}
+
+func TestPricingEngineCapsAndFloors(t *testing.T) {
+	lines := []CartLine{
+		{ProductID: 1, UnitPrice: dec("1000"), Quantity: 3},
+		{ProductID: 2, UnitPrice: dec("500"), Quantity: 2},
+	}
+
+	tests := []struct {
+		name      string
+		engine    *PricingEngine
+		discounts []models.Discount
+		amounts   []models.Decimal // 各規則的折抵金額
+		caps      [][]SavingsCap
+		lineTotal []models.Decimal // 各明細折扣後金額
+	}{
+		{
+			name:      "百分比折扣受最高折抵金額限制",
+			engine:    NewPricingEngine(),
+			discounts: []models.Discount{{ID: 1, Type: models.Percentage, Value: dec("30"), MaxSavings: dec("400")}},
+			amounts:   []models.Decimal{dec("400")},
+			caps:      [][]SavingsCap{{CapMaxSavings}},
+			lineTotal: []models.Decimal{dec("2700"), dec("900")}, // 依原本的比例 300:100 縮減
+		},
+		{
+			name:      "未超過最高折抵金額",
+			engine:    NewPricingEngine(),
+			discounts: []models.Discount{{ID: 1, Type: models.Percentage, Value: dec("10"), MaxSavings: dec("400")}},
+			amounts:   []models.Decimal{dec("400")},
+			caps:      [][]SavingsCap{nil},
+			lineTotal: []models.Decimal{dec("2700"), dec("900")},
+		},
+		{
+			name:      "固定金額不會讓明細低於零",
+			engine:    NewPricingEngine(),
+			discounts: []models.Discount{{ID: 1, Type: models.Fixed, Value: dec("5000"), Products: []models.DiscountProduct{{ProductID: 2}}}},
+			amounts:   []models.Decimal{dec("1000")},
+			caps:      [][]SavingsCap{{CapLineFloor}},
+			lineTotal: []models.Decimal{dec("3000"), dec("0")},
+		},
+		{
+			name:      "明細最低應付金額",
+			engine:    NewPricingEngine().WithPriceFloors(dec("100"), dec("0")),
+			discounts: []models.Discount{{ID: 1, Type: models.Percentage, Value: dec("100")}},
+			amounts:   []models.Decimal{dec("3800")},
+			caps:      [][]SavingsCap{{CapLineFloor}},
+			lineTotal: []models.Decimal{dec("100"), dec("100")},
+		},
+		{
+			name:   "購物車最低應付金額限制後續折扣",
+			engine: NewPricingEngine().WithPriceFloors(dec("0"), dec("3000")),
+			discounts: []models.Discount{
+				{ID: 1, Type: models.Fixed, Value: dec("800")},
+				{ID: 2, Type: models.Percentage, Value: dec("50")},
+			},
+			amounts:   []models.Decimal{dec("800"), dec("200")},
+			caps:      [][]SavingsCap{nil, {CapCartFloor}},
+			lineTotal: []models.Decimal{dec("2250"), dec("750")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.engine.Calculate(lines, tt.discounts)
+			assert.Len(t, result.Rules, len(tt.amounts))
+			for i, rule := range result.Rules {
+				assert.Equal(t, tt.amounts[i], rule.Amount)
+				assert.Equal(t, tt.caps[i], rule.Caps)
+			}
+			for i, line := range result.Lines {
+				assert.Equal(t, tt.lineTotal[i], line.Total)
+			}
+			assert.Equal(t, result.Subtotal.Sub(result.TotalDiscount), result.Total)
+		})
+	}
+}
+
+func TestPricingEngineShipping(t *testing.T) {
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("500"), Quantity: 2}}
+
+	tests := []struct {
+		name      string
+		discounts []models.Discount
+		shipping  models.Decimal // 預期折扣後運費
+		total     models.Decimal
+	}{
+		{
+			name:      "沒有運費折扣",
+			discounts: []models.Discount{{ID: 1, Type: models.Percentage, Value: dec("10")}},
+			shipping:  dec("80"),
+			total:     dec("980"),
+		},
+		{
+			name: "免運費不影響商品折扣",
+			discounts: []models.Discount{
+				{ID: 1, Type: models.Percentage, Value: dec("10")},
+				{ID: 2, Type: models.FreeShipping},
+			},
+			shipping: dec("0"),
+			total:    dec("900"),
+		},
+		{
+			name:      "運費折扣百分比",
+			discounts: []models.Discount{{ID: 1, Type: models.ShippingPercent, Value: dec("50")}},
+			shipping:  dec("40"),
+			total:     dec("1040"),
+		},
+		{
+			name:      "運費折扣上限",
+			discounts: []models.Discount{{ID: 1, Type: models.FreeShipping, MaxSavings: dec("60")}},
+			shipping:  dec("20"),
+			total:     dec("1020"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewPricingEngine().CalculateWithShipping(lines, dec("80"), tt.discounts)
+			assert.Equal(t, dec("80"), result.Shipping.Fee)
+			assert.Equal(t, tt.shipping, result.Shipping.Total)
+			assert.Equal(t, tt.total, result.Total)
+			assert.Equal(t, result.Subtotal.Add(result.Shipping.Fee).Sub(result.TotalDiscount), result.Total)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"shopping_cart/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductNotFound         = errors.New("product not found")
+	ErrProductInactive         = errors.New("product is not available")
+	ErrInvalidProduct          = errors.New("invalid product")
+	ErrProductCurrencyMismatch = errors.New("product is not priced in the cart currency")
+)
+
+type ProductService struct {
+	db *gorm.DB
+}
+
+func NewProductService(db *gorm.DB) *ProductService {
+	return &ProductService{db: db}
+}
+
+// WithTx 回傳在指定交易中操作的 ProductService
+func (s *ProductService) WithTx(tx *gorm.DB) *ProductService {
+	clone := *s
+	clone.db = tx
+	return &clone
+}
+
+func (s *ProductService) CreateProduct(ctx context.Context, product *models.Product) error {
+	if err := normalizeProduct(product); err != nil {
+		return err
+	}
+
+	product.CreatedAt = time.Now()
+	product.UpdatedAt = time.Now()
+	return s.db.WithContext(ctx).Create(product).Error
+}
+
+// UpdateProduct 以 product 的內容取代既有商品，包含下架
+func (s *ProductService) UpdateProduct(ctx context.Context, id int64, product *models.Product) error {
+	existing, err := s.GetProduct(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := normalizeProduct(product); err != nil {
+		return err
+	}
+
+	product.ID = existing.ID
+	product.CreatedAt = existing.CreatedAt
+	product.UpdatedAt = time.Now()
+	// 明確指定欄位，讓 Active 為 false 時也會寫入
+	return s.db.WithContext(ctx).Model(existing).
+		Select("name", "price", "currency", "category", "brand", "tags", "active", "updated_at").
+		Updates(product).Error
+}
+
+func (s *ProductService) DeleteProduct(ctx context.Context, id int64) error {
+	return s.db.WithContext(ctx).Delete(&models.Product{}, id).Error
+}
+
+func (s *ProductService) GetProduct(ctx context.Context, id int64) (*models.Product, error) {
+	product := &models.Product{}
+	err := s.db.WithContext(ctx).First(product, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrProductNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// ListProducts 列出商品，activeOnly 為 true 時只列出上架中的商品
+func (s *ProductService) ListProducts(ctx context.Context, activeOnly bool) ([]models.Product, error) {
+	query := s.db.WithContext(ctx).Order("id")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+
+	var products []models.Product
+	if err := query.Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// CatalogLines 以商品目錄的售價、類別、品牌與標籤取代明細的內容，只保留商品與數量。
+// 商品不存在、已下架或不是以 currency 計價時回傳錯誤
+func (s *ProductService) CatalogLines(ctx context.Context, lines []CartLine, currency models.Currency) ([]CartLine, error) {
+	currency, err := models.ParseCurrency(string(currency))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ProductID)
+	}
+	var products []models.Product
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	catalog := make(map[int64]models.Product, len(products))
+	for _, p := range products {
+		catalog[p.ID] = p
+	}
+
+	priced := make([]CartLine, len(lines))
+	for i, line := range lines {
+		product, ok := catalog[line.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrProductNotFound, line.ProductID)
+		}
+		if !product.Active {
+			return nil, fmt.Errorf("%w: %d", ErrProductInactive, line.ProductID)
+		}
+		if product.Currency != currency {
+			return nil, fmt.Errorf("%w: product %d is priced in %s", ErrProductCurrencyMismatch, line.ProductID, product.Currency)
+		}
+		priced[i] = CartLine{
+			ProductID: product.ID,
+			UnitPrice: product.Price,
+			Quantity:  line.Quantity,
+			Category:  product.Category,
+			Brand:     product.Brand,
+			Tags:      product.TagList(),
+		}
+	}
+	return priced, nil
+}
+
+// normalizeProduct 檢查商品內容並統一貨幣與標籤格式
+func normalizeProduct(product *models.Product) error {
+	product.Name = strings.TrimSpace(product.Name)
+	if product.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProduct)
+	}
+	if product.Price.IsNegative() {
+		return fmt.Errorf("%w: price cannot be negative", ErrInvalidProduct)
+	}
+
+	currency, err := models.ParseCurrency(string(product.Currency))
+	if err != nil {
+		return err
+	}
+	product.Currency = currency
+	product.Category = strings.TrimSpace(product.Category)
+	product.Brand = strings.TrimSpace(product.Brand)
+	product.Tags = models.JoinTags([]string{product.Tags})
+	return nil
+}
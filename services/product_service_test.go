@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductCatalog(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewProductService(db)
+	ctx := context.Background()
+
+	shoes := &models.Product{Name: " Runner ", Price: dec("1200"), Category: "Shoes", Brand: "Acme", Tags: "new-arrival, sale", Active: true}
+	assert.NoError(t, service.CreateProduct(ctx, shoes))
+	assert.Equal(t, "Runner", shoes.Name)
+	assert.Equal(t, models.DefaultCurrency, shoes.Currency)
+	assert.Equal(t, []string{"new-arrival", "sale"}, shoes.TagList())
+
+	socks := &models.Product{Name: "Socks", Price: dec("150"), Category: "Socks", Active: true}
+	assert.NoError(t, service.CreateProduct(ctx, socks))
+
+	// 無效的商品
+	assert.ErrorIs(t, service.CreateProduct(ctx, &models.Product{Name: " "}), ErrInvalidProduct)
+	assert.ErrorIs(t, service.CreateProduct(ctx, &models.Product{Name: "Invalid", Price: dec("-1")}), ErrInvalidProduct)
+	assert.ErrorIs(t, service.CreateProduct(ctx, &models.Product{Name: "Invalid", Currency: "X"}), models.ErrInvalidCurrency)
+
+	// 下架
+	assert.NoError(t, service.UpdateProduct(ctx, socks.ID, &models.Product{Name: "Socks", Price: dec("120"), Category: "Socks", Active: false}))
+	product, err := service.GetProduct(ctx, socks.ID)
+	assert.NoError(t, err)
+	assert.False(t, product.Active)
+	assert.Equal(t, dec("120"), product.Price)
+
+	products, err := service.ListProducts(ctx, true)
+	assert.NoError(t, err)
+	assert.Len(t, products, 1)
+	products, err = service.ListProducts(ctx, false)
+	assert.NoError(t, err)
+	assert.Len(t, products, 2)
+
+	// 明細以目錄的售價與類別為準
+	lines, err := service.CatalogLines(ctx, []CartLine{{ProductID: shoes.ID, UnitPrice: dec("1"), Quantity: 2, Category: "Socks"}}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []CartLine{{ProductID: shoes.ID, UnitPrice: dec("1200"), Quantity: 2, Category: "Shoes", Brand: "Acme", Tags: []string{"new-arrival", "sale"}}}, lines)
+
+	_, err = service.CatalogLines(ctx, []CartLine{{ProductID: socks.ID, Quantity: 1}}, "")
+	assert.ErrorIs(t, err, ErrProductInactive)
+	_, err = service.CatalogLines(ctx, []CartLine{{ProductID: 999, Quantity: 1}}, "")
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	_, err = service.CatalogLines(ctx, []CartLine{{ProductID: shoes.ID, Quantity: 1}}, models.USD)
+	assert.ErrorIs(t, err, ErrProductCurrencyMismatch)
+
+	assert.NoError(t, service.DeleteProduct(ctx, socks.ID))
+	_, err = service.GetProduct(ctx, socks.ID)
+	assert.ErrorIs(t, err, ErrProductNotFound)
+}
+
+func TestCartUsesProductCatalog(t *testing.T) {
+	db := setupTestDB(t)
+	products := NewProductService(db)
+	service := NewCartService(db).WithProductService(products)
+	ctx := context.Background()
+
+	shoes := &models.Product{Name: "Runner", Price: dec("1200"), Category: "Shoes", Brand: "Acme", Tags: "sale", Active: true}
+	assert.NoError(t, products.CreateProduct(ctx, shoes))
+	retired := &models.Product{Name: "Retired", Price: dec("100")}
+	assert.NoError(t, products.CreateProduct(ctx, retired))
+
+	cart, err := service.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+
+	// 不接受客戶端提供的價格與類別
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: shoes.ID, UnitPrice: dec("1"), Quantity: 2})
+	assert.ErrorIs(t, err, ErrCatalogFieldsSet)
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: shoes.ID, Quantity: 2, Category: "Free"})
+	assert.ErrorIs(t, err, ErrCatalogFieldsSet)
+
+	cart, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: shoes.ID, Quantity: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("1200"), cart.Items[0].UnitPrice)
+	assert.Equal(t, "Shoes", cart.Items[0].Category)
+	assert.Equal(t, "Acme", cart.Items[0].Brand)
+	assert.Equal(t, dec("2400"), cart.Subtotal)
+
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: retired.ID, Quantity: 1})
+	assert.ErrorIs(t, err, ErrProductInactive)
+	_, err = service.AddItem(ctx, cart.ID, CartItemInput{ProductID: 999, Quantity: 1})
+	assert.ErrorIs(t, err, ErrProductNotFound)
+
+	usdCart, err := service.CreateCartInCurrency(ctx, 1, models.USD)
+	assert.NoError(t, err)
+	_, err = service.AddItem(ctx, usdCart.ID, CartItemInput{ProductID: shoes.ID, Quantity: 1})
+	assert.ErrorIs(t, err, ErrProductCurrencyMismatch)
+}
+
+func TestCheckoutUsesCurrentCatalogPrice(t *testing.T) {
+	db := setupTestDB(t)
+	products := NewProductService(db)
+	carts := NewCartService(db).WithProductService(products)
+	checkout := NewCheckoutService(db, NewDiscountService(db)).WithProductService(products)
+	ctx := context.Background()
+
+	shoes := &models.Product{Name: "Runner", Price: dec("1200"), Category: "Shoes", Active: true}
+	assert.NoError(t, products.CreateProduct(ctx, shoes))
+	cart, err := carts.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	cart, err = carts.AddItem(ctx, cart.ID, CartItemInput{ProductID: shoes.ID, Quantity: 2})
+	assert.NoError(t, err)
+
+	// 加入購物車後調漲售價，計價與結帳以目錄目前的售價為準
+	assert.NoError(t, products.UpdateProduct(ctx, shoes.ID, &models.Product{Name: "Runner", Price: dec("1500"), Category: "Shoes", Active: true}))
+	lines, err := carts.PricedLines(ctx, cart)
+	assert.NoError(t, err)
+	assert.Equal(t, dec("1500"), lines[0].UnitPrice)
+
+	order, err := checkout.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{}})
+	assert.NoError(t, err)
+	assert.Equal(t, dec("1500"), order.Items[0].UnitPrice)
+	assert.Equal(t, dec("3000"), order.Total)
+
+	// 下架的商品無法計價或結帳
+	cart, err = carts.CreateCart(ctx, 1)
+	assert.NoError(t, err)
+	cart, err = carts.AddItem(ctx, cart.ID, CartItemInput{ProductID: shoes.ID, Quantity: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, products.UpdateProduct(ctx, shoes.ID, &models.Product{Name: "Runner", Price: dec("1500"), Category: "Shoes", Active: false}))
+
+	_, err = carts.PricedLines(ctx, cart)
+	assert.ErrorIs(t, err, ErrProductInactive)
+	_, err = checkout.Checkout(ctx, CheckoutInput{CartID: cart.ID, ExpectedDiscountIDs: []int64{}})
+	assert.ErrorIs(t, err, ErrProductInactive)
+}
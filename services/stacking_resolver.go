@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"shopping_cart/models"
+)
+
+var ErrInvalidStackingStrategy = errors.New("invalid stacking strategy")
+
+// 決定折扣組合的策略
+type StackingStrategy string
+
+const (
+	StrategyPriority   StackingStrategy = "PRIORITY"    // 依優先級選擇 (預設)
+	StrategyMaxSavings StackingStrategy = "MAX_SAVINGS" // 選擇折抵金額最大的組合
+)
+
+// 最佳化時最多比較的不可疊加折扣數量，避免大量折扣時計算過久
+const maxOptimizerCandidates = 16
+
+// ParseStackingStrategy 解析策略字串，空白時使用優先級策略
+func ParseStackingStrategy(value string) (StackingStrategy, error) {
+	switch strategy := StackingStrategy(strings.ToUpper(strings.TrimSpace(value))); strategy {
+	case "":
+		return StrategyPriority, nil
+	case StrategyPriority, StrategyMaxSavings:
+		return strategy, nil
+	}
+	return "", ErrInvalidStackingStrategy
+}
+
+// 單一折扣的疊加決策
+type StackingDecision struct {
+	DiscountID   int64                   `json:"discount_id"`
+	DiscountName string                  `json:"discount_name"`
+	Priority     models.DiscountPriority `json:"priority"`
+	Stackable    bool                    `json:"stackable"`
+	Applied      bool                    `json:"applied"`
+	Reason       string                  `json:"reason"`
+}
+
+// 疊加的結果，Applied 依套用順序排列
+type StackingResolution struct {
+	Applied   []models.Discount
+	Decisions []StackingDecision
+}
+
+type StackingResolver struct {
+	engine      *PricingEngine
+	shippingFee models.Decimal // 比較運費折扣的折抵金額時使用
+}
+
+func NewStackingResolver() *StackingResolver {
+	return &StackingResolver{engine: NewPricingEngine()}
+}
+
+// WithEngine 回傳以指定計價引擎比較折抵金額的 StackingResolver
+func (r *StackingResolver) WithEngine(engine *PricingEngine) *StackingResolver {
+	clone := *r
+	clone.engine = engine
+	return &clone
+}
+
+// WithShippingFee 回傳以指定運費比較運費折扣的 StackingResolver
+func (r *StackingResolver) WithShippingFee(fee models.Decimal) *StackingResolver {
+	clone := *r
+	clone.shippingFee = fee
+	return &clone
+}
+
+// Resolve 從符合資格的折扣中決定最終套用的組合：
+// 最多套用一個不可疊加的折扣 (優先級最高者) 作為基礎，其餘可疊加的折扣依優先級依序疊加
+// 商品折扣、運費折扣與贈品分開決定，不可疊加只限制同一類的折扣
+func (r *StackingResolver) Resolve(eligible []models.Discount) *StackingResolution {
+	return byTarget(eligible, r.resolveByPriority)
+}
+
+func (r *StackingResolver) resolveByPriority(eligible []models.Discount) *StackingResolution {
+	sorted := sortedDiscounts(eligible)
+
+	var exclusive *models.Discount
+	for i := range sorted {
+		if !sorted[i].Stackable {
+			exclusive = &sorted[i]
+			break
+		}
+	}
+
+	return r.resolve(sorted, exclusive, "highest priority non-stackable discount", "not stackable with higher priority discount %q")
+}
+
+// MaximizeSavings 與 Resolve 相同最多套用一個不可疊加的折扣，但選擇讓總折抵金額最大的那一個
+// 可疊加的折扣只會增加折抵，因此每個組合都包含全部可疊加折扣，只需比較不可疊加折扣的選擇
+func (r *StackingResolver) MaximizeSavings(eligible []models.Discount, lines []CartLine) *StackingResolution {
+	return byTarget(eligible, func(group []models.Discount) *StackingResolution {
+		return r.maximizeSavings(group, lines)
+	})
+}
+
+func (r *StackingResolver) maximizeSavings(eligible []models.Discount, lines []CartLine) *StackingResolution {
+	sorted := sortedDiscounts(eligible)
+
+	stackables := make([]models.Discount, 0, len(sorted))
+	exclusives := make([]*models.Discount, 0, len(sorted))
+	for i := range sorted {
+		if sorted[i].Stackable {
+			stackables = append(stackables, sorted[i])
+		} else {
+			exclusives = append(exclusives, &sorted[i])
+		}
+	}
+	if len(exclusives) <= 1 {
+		return r.resolveByPriority(eligible)
+	}
+
+	engine := r.engine
+	savings := func(exclusive *models.Discount) models.Decimal {
+		combination := append([]models.Discount{*exclusive}, stackables...)
+		return engine.CalculateWithShipping(lines, r.shippingFee, combination).TotalDiscount
+	}
+
+	// 先以單獨套用的折抵金額排序，只保留前幾名與疊加折扣組合比較
+	standalone := make(map[int64]models.Decimal, len(exclusives))
+	for _, d := range exclusives {
+		standalone[d.ID] = engine.CalculateWithShipping(lines, r.shippingFee, []models.Discount{*d}).TotalDiscount
+	}
+	candidates := make([]*models.Discount, len(exclusives))
+	copy(candidates, exclusives)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return standalone[candidates[i].ID].GreaterThan(standalone[candidates[j].ID])
+	})
+	if len(candidates) > maxOptimizerCandidates {
+		candidates = candidates[:maxOptimizerCandidates]
+	}
+
+	// 折抵金額相同時維持優先級的選擇
+	best := exclusives[0]
+	bestSavings := savings(best)
+	for _, candidate := range candidates {
+		if candidate == exclusives[0] {
+			continue
+		}
+		if amount := savings(candidate); amount.GreaterThan(bestSavings) {
+			best, bestSavings = candidate, amount
+		}
+	}
+
+	return r.resolve(sorted, best, "non-stackable discount with the largest savings", "not stackable with discount %q, which saves more")
+}
+
+// resolve 以選定的不可疊加折扣為基礎，依優先級疊加其餘可疊加的折扣並記錄決策
+func (r *StackingResolver) resolve(sorted []models.Discount, exclusive *models.Discount, appliedReason, skippedFormat string) *StackingResolution {
+	resolution := &StackingResolution{
+		Applied:   make([]models.Discount, 0, len(sorted)),
+		Decisions: make([]StackingDecision, 0, len(sorted)),
+	}
+	if exclusive != nil {
+		resolution.Applied = append(resolution.Applied, *exclusive)
+	}
+
+	for i := range sorted {
+		discount := &sorted[i]
+		decision := StackingDecision{
+			DiscountID:   discount.ID,
+			DiscountName: discount.Name,
+			Priority:     discount.Priority,
+			Stackable:    discount.Stackable,
+		}
+
+		switch {
+		case discount.Stackable:
+			decision.Applied = true
+			decision.Reason = "stackable, applied in priority order"
+			resolution.Applied = append(resolution.Applied, *discount)
+		case discount == exclusive:
+			decision.Applied = true
+			decision.Reason = appliedReason
+		default:
+			decision.Reason = fmt.Sprintf(skippedFormat, exclusive.Name)
+		}
+
+		resolution.Decisions = append(resolution.Decisions, decision)
+	}
+
+	return resolution
+}
+
+// byTarget 將折扣分為商品折扣、運費折扣與贈品各自決定，再依序合併結果
+func byTarget(eligible []models.Discount, resolve func([]models.Discount) *StackingResolution) *StackingResolution {
+	items := make([]models.Discount, 0, len(eligible))
+	var shipping, gifts []models.Discount
+	for _, discount := range eligible {
+		switch {
+		case discount.Type.IsShipping():
+			shipping = append(shipping, discount)
+		case discount.Type == models.Gift:
+			gifts = append(gifts, discount)
+		default:
+			items = append(items, discount)
+		}
+	}
+
+	resolution := resolve(items)
+	for _, group := range [][]models.Discount{shipping, gifts} {
+		if len(group) == 0 {
+			continue
+		}
+		groupResolution := resolve(group)
+		resolution.Applied = append(resolution.Applied, groupResolution.Applied...)
+		resolution.Decisions = append(resolution.Decisions, groupResolution.Decisions...)
+	}
+	return resolution
+}
+
+func sortedDiscounts(discounts []models.Discount) []models.Discount {
+	sorted := make([]models.Discount, len(discounts))
+	copy(sorted, discounts)
+	sortDiscounts(sorted)
+	return sorted
+}
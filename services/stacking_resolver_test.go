@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+
+	"shopping_cart/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackingResolver(t *testing.T) {
+	resolver := NewStackingResolver()
+
+	tests := []struct {
+		name     string
+		eligible []models.Discount
+		applied  []int64 // 預期的套用順序
+		skipped  []int64
+	}{
+		{
+			name:    "沒有折扣",
+			applied: []int64{},
+		},
+		{
+			name: "只有可疊加折扣時依優先級疊加",
+			eligible: []models.Discount{
+				{ID: 1, Priority: models.PriorityLow, Stackable: true},
+				{ID: 2, Priority: models.PriorityHigh, Stackable: true},
+				{ID: 3, Priority: models.PriorityMedium, Stackable: true},
+			},
+			applied: []int64{2, 3, 1},
+		},
+		{
+			name: "最多一個不可疊加折扣",
+			eligible: []models.Discount{
+				{ID: 1, Priority: models.PriorityMedium},
+				{ID: 2, Priority: models.PriorityHigh},
+				{ID: 3, Priority: models.PriorityLow},
+			},
+			applied: []int64{2},
+			skipped: []int64{1, 3},
+		},
+		{
+			name: "不可疊加折扣作為基礎，再疊加可疊加折扣",
+			eligible: []models.Discount{
+				{ID: 1, Priority: models.PriorityHigh, Stackable: true},
+				{ID: 2, Priority: models.PriorityMedium, Stackable: true},
+				{ID: 3, Priority: models.PriorityLow},
+				{ID: 4, Priority: models.PriorityLow},
+			},
+			applied: []int64{3, 1, 2},
+			skipped: []int64{4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolution := resolver.Resolve(tt.eligible)
+
+			applied := make([]int64, 0, len(resolution.Applied))
+			for _, d := range resolution.Applied {
+				applied = append(applied, d.ID)
+			}
+			assert.Equal(t, tt.applied, applied)
+
+			var skipped []int64
+			for _, decision := range resolution.Decisions {
+				if !decision.Applied {
+					assert.NotEmpty(t, decision.Reason)
+					skipped = append(skipped, decision.DiscountID)
+				}
+			}
+			assert.Equal(t, tt.skipped, skipped)
+			assert.Len(t, resolution.Decisions, len(tt.eligible))
+		})
+	}
+}
+
+func TestStackingResolverMaximizeSavings(t *testing.T) {
+	resolver := NewStackingResolver()
+	lines := []CartLine{{ProductID: 1, UnitPrice: dec("100"), Quantity: 2}}
+
+	// 折抵金額相同時維持優先級的選擇
+	tied := []models.Discount{
+		{ID: 1, Name: "A", Type: models.Fixed, Value: dec("30"), Priority: models.PriorityLow},
+		{ID: 2, Name: "B", Type: models.Fixed, Value: dec("30"), Priority: models.PriorityHigh},
+	}
+	resolution := resolver.MaximizeSavings(tied, lines)
+	assert.Equal(t, int64(2), resolution.Applied[0].ID)
+
+	// 大量折扣時只比較單獨折抵最多的候選，結果仍是最佳組合
+	eligible := make([]models.Discount, 0, 50)
+	for i := 1; i <= 50; i++ {
+		eligible = append(eligible, models.Discount{ID: int64(i), Name: "Fixed", Type: models.Fixed, Value: models.NewDecimal(int64(i)), Priority: models.PriorityHigh})
+	}
+	eligible = append(eligible, models.Discount{ID: 51, Name: "5%", Type: models.Percentage, Value: dec("5"), Stackable: true})
+
+	resolution = resolver.MaximizeSavings(eligible, lines)
+	assert.Len(t, resolution.Applied, 2)
+	assert.Equal(t, int64(50), resolution.Applied[0].ID)
+	assert.Equal(t, int64(51), resolution.Applied[1].ID)
+	assert.Len(t, resolution.Decisions, 51)
+}
+
+func TestParseStackingStrategy(t *testing.T) {
+	strategy, err := ParseStackingStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyPriority, strategy)
+
+	strategy, err = ParseStackingStrategy(" max_savings ")
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyMaxSavings, strategy)
+
+	_, err = ParseStackingStrategy("CHEAPEST")
+	assert.ErrorIs(t, err, ErrInvalidStackingStrategy)
+}